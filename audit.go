@@ -0,0 +1,50 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type auditRecord struct {
+	Timestamp  time.Time   `json:"timestamp"`
+	Executable string      `json:"executable"`
+	Argv       []string    `json:"argv"`
+	Config     auditConfig `json:"config"`
+}
+
+type auditConfig struct {
+	Root     string `json:"root"`
+	Files    int    `json:"files"`
+	Mounts   int    `json:"mounts"`
+	Env      int    `json:"env"`
+	NoNewNet bool   `json:"no_new_net"`
+	CGroup   string `json:"cgroup,omitempty"`
+	CpuSet   string `json:"cpuset,omitempty"`
+	MemLimit uint64 `json:"mem_limit,omitempty"`
+}
+
+// WriteCommandAudit writes a JSON audit record of the sandbox tool invocation for the given command
+// to w, followed by a newline.
+//
+// The record holds the current time, the sandbox executable, its full argv and a short summary of
+// the configuration. Secret environment values are redacted the same way as in CommandLine.
+func (s *Sandbox) WriteCommandAudit(w io.Writer, path string, args ...string) error {
+	rec := auditRecord{
+		Timestamp:  time.Now().UTC(),
+		Executable: Path,
+		Argv:       s.buildExecArgs(path, args, true),
+		Config: auditConfig{
+			Root:     s.path,
+			Files:    len(s.files),
+			Mounts:   len(s.mountDirs),
+			Env:      len(s.env),
+			NoNewNet: s.noNewNet,
+			CGroup:   s.cgroup,
+			CpuSet:   s.cpuSet,
+			MemLimit: s.memLimit,
+		},
+	}
+
+	return json.NewEncoder(w).Encode(rec)
+}
@@ -0,0 +1,38 @@
+package sandbox_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestWriteCommandAudit(t *testing.T) {
+	sbox := sandbox.New("/root").AddSecretEnv("TOKEN", "s3cr3t").SetMemLimit(1024)
+
+	var buf bytes.Buffer
+	if err := sbox.WriteCommandAudit(&buf, "/bin/echo", "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(buf.String(), "s3cr3t") {
+		t.Fatalf("secret leaked into audit record: %s", buf.String())
+	}
+
+	var rec struct {
+		Executable string   `json:"executable"`
+		Argv       []string `json:"argv"`
+		Config     struct {
+			MemLimit uint64 `json:"mem_limit"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Executable != sandbox.Path || !hasArgs(rec.Argv, "--env", "TOKEN=***") || rec.Config.MemLimit != 1024 {
+		t.Fatalf("audit record: %s", buf.String())
+	}
+}
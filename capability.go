@@ -0,0 +1,81 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+)
+
+var (
+	toolFlagsMu    sync.Mutex
+	toolFlagsCache = make(map[string]map[string]bool)
+	helpFlagRe     = regexp.MustCompile(`--[a-z0-9_]+`)
+)
+
+// SupportsFlag reports whether the installed sandbox tool accepts flag, such as "--mem_high".
+//
+// The tool is asked for its flags once per Path, by running it with --help, and the answer is
+// cached. An error is returned if the tool cannot be run or prints no help.
+func SupportsFlag(flag string) (bool, error) {
+	flags, err := toolFlags()
+	if err != nil {
+		return false, err
+	}
+
+	return flags[flag], nil
+}
+
+func toolFlags() (map[string]bool, error) {
+	toolFlagsMu.Lock()
+	defer toolFlagsMu.Unlock()
+
+	if flags, ok := toolFlagsCache[Path]; ok {
+		return flags, nil
+	}
+
+	// The exit status of --help varies between versions, so only the output matters.
+	out, err := execCommandContext(context.Background(), Path, "--help").CombinedOutput()
+	if len(out) == 0 {
+		if err == nil {
+			err = errors.New("sandbox: the sandbox tool printed no help")
+		}
+		return nil, err
+	}
+
+	flags := make(map[string]bool)
+	for _, f := range helpFlagRe.FindAllString(string(out), -1) {
+		flags[f] = true
+	}
+	toolFlagsCache[Path] = flags
+
+	return flags, nil
+}
+
+// SetStrictFlags makes BuildExecArgsE fail with ErrUnsupportedFlag if the configuration would emit
+// a flag that the installed sandbox tool does not support, as reported by SupportsFlag. It catches
+// version mismatches between the library and the tool before anything is run.
+func (s *Sandbox) SetStrictFlags(v bool) *Sandbox {
+	s.strictFlags = v
+
+	return s
+}
+
+func (s *Sandbox) validateFlags() error {
+	if !s.strictFlags {
+		return nil
+	}
+
+	supported, err := toolFlags()
+	if err != nil {
+		return configErr("flags", -1, err, "cannot query the sandbox tool flags: %v", err)
+	}
+
+	for _, group := range splitFlags(s.buildFlags(true)[1:]) {
+		if !supported[group[0]] {
+			return configErr("flags", -1, ErrUnsupportedFlag, "%s is not supported by %s", group[0], Path)
+		}
+	}
+
+	return nil
+}
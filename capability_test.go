@@ -0,0 +1,39 @@
+package sandbox_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestStrictFlags(t *testing.T) {
+	script := writeFile(t, "tool.sh", `#!/bin/sh
+echo "usage: sandbox <root> [--mem_limit bytes] [--env KEY=VALUE] -- command"
+exit 1
+`)
+	if err := os.Chmod(script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	withToolPath(t, script)
+
+	for flag, want := range map[string]bool{"--mem_limit": true, "--env": true, "--mem_high": false} {
+		if got, err := sandbox.SupportsFlag(flag); err != nil || got != want {
+			t.Fatalf("SupportsFlag(%q) = %t, %v", flag, got, err)
+		}
+	}
+
+	sbox := sandbox.New("/root").SetStrictFlags(true).SetMemLimit(1 << 20).AddEnv("A=--mem_high").AddEnv("--foo")
+	if _, err := sbox.BuildExecArgsE("/bin/true", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sbox.SetMemHigh(1<<19).BuildExecArgsE("/bin/true", nil); !errors.Is(err, sandbox.ErrUnsupportedFlag) {
+		t.Fatalf("expected ErrUnsupportedFlag, got %v", err)
+	}
+
+	if _, err := sbox.SetStrictFlags(false).BuildExecArgsE("/bin/true", nil); err != nil {
+		t.Fatal(err)
+	}
+}
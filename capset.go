@@ -0,0 +1,42 @@
+package sandbox
+
+import "strings"
+
+// capabilityNames lists the Linux capabilities accepted by SetCapabilitySet, see capabilities(7).
+var capabilityNames = map[string]bool{
+	"chown": true, "dac_override": true, "dac_read_search": true, "fowner": true, "fsetid": true,
+	"kill": true, "setgid": true, "setuid": true, "setpcap": true, "linux_immutable": true,
+	"net_bind_service": true, "net_broadcast": true, "net_admin": true, "net_raw": true,
+	"ipc_lock": true, "ipc_owner": true, "sys_module": true, "sys_rawio": true, "sys_chroot": true,
+	"sys_ptrace": true, "sys_pacct": true, "sys_admin": true, "sys_boot": true, "sys_nice": true,
+	"sys_resource": true, "sys_time": true, "sys_tty_config": true, "mknod": true, "lease": true,
+	"audit_write": true, "audit_control": true, "setfcap": true, "mac_override": true,
+	"mac_admin": true, "syslog": true, "wake_alarm": true, "block_suspend": true, "audit_read": true,
+	"perfmon": true, "bpf": true, "checkpoint_restore": true,
+}
+
+// SetCapabilitySet sets the capability bounding set of the sandboxed process to exactly the
+// listed capabilities, so that a configuration provably grants nothing beyond them. Names are
+// case-insensitive and may have the CAP_ prefix, e.g. "CAP_NET_BIND_SERVICE" or "net_bind_service";
+// Validate rejects unknown ones. Calling it with no capabilities drops them all.
+//
+// The list replaces any earlier one, and it is the only way to configure capabilities: without
+// it, the sandbox tool default applies.
+func (s *Sandbox) SetCapabilitySet(caps ...string) *Sandbox {
+	s.capSet = make([]string, len(caps))
+	for i, c := range caps {
+		s.capSet[i] = strings.TrimPrefix(strings.ToLower(c), "cap_")
+	}
+
+	return s
+}
+
+func (s *Sandbox) validateCapabilities() error {
+	for i, c := range s.capSet {
+		if !capabilityNames[c] {
+			return configErr("cap_bounding_set", i, nil, "unknown capability %q", c)
+		}
+	}
+
+	return nil
+}
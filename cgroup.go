@@ -0,0 +1,106 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// CgroupRoot is the mount point of the cgroup v2 hierarchy. Cgroup names passed to SetCGroup are
+// relative to it.
+var CgroupRoot = "/sys/fs/cgroup"
+
+// defaultCpuMaxPeriod is the cpu.max period used when none is given, in microseconds.
+const defaultCpuMaxPeriod = 100000
+
+// CgroupLimits holds cgroup v2 resource limits. Zero fields are left at the cgroup defaults.
+type CgroupLimits struct {
+	// MemoryMax is written to memory.max, in bytes.
+	MemoryMax uint64
+	// CpuMaxQuota and CpuMaxPeriod are written to cpu.max, in microseconds; see SetCpuMax.
+	CpuMaxQuota  uint64
+	CpuMaxPeriod uint64
+	// PidsMax is written to pids.max.
+	PidsMax uint64
+}
+
+// files returns the cgroup control files and their contents for the non-zero limits.
+func (l CgroupLimits) files() [][2]string {
+	var files [][2]string
+
+	if l.MemoryMax != 0 {
+		files = append(files, [2]string{"memory.max", strconv.FormatUint(l.MemoryMax, 10)})
+	}
+
+	if l.CpuMaxQuota != 0 {
+		period := l.CpuMaxPeriod
+		if period == 0 {
+			period = defaultCpuMaxPeriod
+		}
+
+		files = append(files, [2]string{"cpu.max", strconv.FormatUint(l.CpuMaxQuota, 10) + " " + strconv.FormatUint(period, 10)})
+	}
+
+	if l.PidsMax != 0 {
+		files = append(files, [2]string{"pids.max", strconv.FormatUint(l.PidsMax, 10)})
+	}
+
+	return files
+}
+
+// WriteCgroupConfig writes the resource limits set with SetMemLimit, SetCpuMax and SetPidLimit to
+// w as a cgroup v2 configuration fragment, one "file value" line per control file: memory.max,
+// cpu.max and pids.max. Limits that are not set are omitted, and a zero cpu.max period defaults to
+// 100000, as with WithEphemeralCgroup. It lets external tooling pre-create the cgroup passed to
+// SetCGroup with matching limits.
+func (s *Sandbox) WriteCgroupConfig(w io.Writer) error {
+	limits := CgroupLimits{
+		MemoryMax:    s.memLimit,
+		CpuMaxQuota:  s.cpuMaxQuota,
+		CpuMaxPeriod: s.cpuMaxPeriod,
+		PidsMax:      s.pidsMax,
+	}
+
+	for _, f := range limits.files() {
+		if _, err := fmt.Fprintf(w, "%s %s\n", f[0], f[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WithEphemeralCgroup creates a new child cgroup under parent, a path relative to CgroupRoot,
+// applies limits to it and assigns the sandbox to it with SetCGroup.
+//
+// The returned cleanup function removes the cgroup; it must be called once the sandboxed process
+// has exited. A zero CpuMaxPeriod defaults to 100000. Creating cgroups requires write access to
+// the parent cgroup, which usually means running as root or with a delegated subtree.
+func (s *Sandbox) WithEphemeralCgroup(parent string, limits CgroupLimits) (cleanup func(), err error) {
+	parentDir := filepath.Join(CgroupRoot, parent)
+
+	dir, err := os.MkdirTemp(parentDir, "sandbox-")
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return nil, fmt.Errorf("sandbox: creating a cgroup under %s requires write access to it: %w", parentDir, err)
+		}
+
+		return nil, fmt.Errorf("sandbox: create cgroup: %w", err)
+	}
+
+	cleanup = func() { os.RemoveAll(dir) }
+
+	for _, f := range limits.files() {
+		if err := os.WriteFile(filepath.Join(dir, f[0]), []byte(f[1]+"\n"), 0o644); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("sandbox: configure cgroup: %w", err)
+		}
+	}
+
+	s.SetCGroup(filepath.Join(parent, filepath.Base(dir)))
+
+	return cleanup, nil
+}
@@ -0,0 +1,66 @@
+package sandbox_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestWithEphemeralCgroup(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "judge"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	prev := sandbox.CgroupRoot
+	sandbox.CgroupRoot = root
+	defer func() { sandbox.CgroupRoot = prev }()
+
+	sbox := sandbox.New("/root")
+
+	cleanup, err := sbox.WithEphemeralCgroup("judge", sandbox.CgroupLimits{MemoryMax: 1024, CpuMaxQuota: 50000, PidsMax: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := sbox.BuildExecArgs("/bin/true", nil)
+
+	var cgroup string
+	for i := range args {
+		if args[i] == "--cgroup" {
+			cgroup = args[i+1]
+		}
+	}
+
+	dir := filepath.Join(root, cgroup)
+	for file, want := range map[string]string{"memory.max": "1024\n", "cpu.max": "50000 100000\n", "pids.max": "8\n"} {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil || string(data) != want {
+			t.Fatalf("%s: %q, %v", file, data, err)
+		}
+	}
+
+	cleanup()
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("cgroup was not removed: %v", err)
+	}
+
+	if _, err := sbox.WithEphemeralCgroup("missing", sandbox.CgroupLimits{}); err == nil {
+		t.Fatal("expected error for missing parent")
+	}
+}
+
+func TestWriteCgroupConfig(t *testing.T) {
+	var b strings.Builder
+	if err := sandbox.New("/root").SetMemLimit(1<<20).SetCpuMax(50000, 0).WriteCgroupConfig(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "memory.max 1048576\ncpu.max 50000 100000\n"; b.String() != want {
+		t.Fatalf("config:\n got: %q\nwant: %q", b.String(), want)
+	}
+}
@@ -0,0 +1,73 @@
+package sandbox
+
+// Snapshot is an opaque copy of a sandbox configuration, created by Sandbox.Snapshot.
+type Snapshot struct {
+	s *Sandbox
+}
+
+// Clone returns an independent copy of the sandbox configuration.
+//
+// Hooks and tee writers are shared with the original. Cleanups registered with AddCleanup belong
+// to the original only and are not copied.
+func (s *Sandbox) Clone() *Sandbox {
+	c := *s
+
+	c.files = append([]file(nil), s.files...)
+	c.libPaths = append([]string(nil), s.libPaths...)
+	c.mountDirs = append([]mountDir(nil), s.mountDirs...)
+	c.env = append([]envVar(nil), s.env...)
+	c.ctxEnv = append([]ctxEnvVar(nil), s.ctxEnv...)
+	c.rlimits = append([]rlimit(nil), s.rlimits...)
+	c.writable = append([]string(nil), s.writable...)
+	c.setupCmd = append([]string(nil), s.setupCmd...)
+	c.labels = append([][2]string(nil), s.labels...)
+	c.sysctls = append([][2]string(nil), s.sysctls...)
+	c.cleanups = nil
+	c.srcPrefixes = append([]string(nil), s.srcPrefixes...)
+	c.dstPrefixes = append([]string(nil), s.dstPrefixes...)
+
+	if s.capSet != nil {
+		c.capSet = append([]string{}, s.capSet...)
+	}
+
+	if s.toolEnv != nil {
+		c.toolEnv = append([]string{}, s.toolEnv...)
+	}
+
+	if s.nice != nil {
+		nice := *s.nice
+		c.nice = &nice
+	}
+
+	if s.oomScoreAdj != nil {
+		adj := *s.oomScoreAdj
+		c.oomScoreAdj = &adj
+	}
+
+	if s.uids != nil {
+		uids := *s.uids
+		c.uids = &uids
+	}
+
+	if s.killChildren != nil {
+		kill := *s.killChildren
+		c.killChildren = &kill
+	}
+
+	return &c
+}
+
+// Snapshot captures the current configuration, so it can later be brought back with Restore.
+func (s *Sandbox) Snapshot() Snapshot {
+	return Snapshot{s: s.Clone()}
+}
+
+// Restore replaces the configuration with the one captured by snap. Pending cleanups are kept.
+// The snapshot itself is not modified and can be restored again.
+func (s *Sandbox) Restore(snap Snapshot) *Sandbox {
+	cleanups := s.cleanups
+	*s = *snap.s.Clone()
+	s.cleanups = cleanups
+
+	return s
+}
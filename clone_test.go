@@ -0,0 +1,36 @@
+package sandbox_test
+
+import (
+	"reflect"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestClone(t *testing.T) {
+	base := sandbox.New("/root").AddEnv("A=1").SetNice(1)
+	want := base.BuildExecArgs("/bin/true", nil)
+
+	base.Clone().AddEnv("B=2").SetNice(2).MountDir("/data", "/data")
+
+	if got := base.BuildExecArgs("/bin/true", nil); !reflect.DeepEqual(got, want) {
+		t.Fatalf("clone modified the original:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	sbox := sandbox.New("/root").AddEnv("A=1").SetMemLimit(1024)
+	want := sbox.BuildExecArgs("/bin/true", nil)
+
+	snap := sbox.Snapshot()
+
+	sbox.AddEnv("B=2").SetMemLimit(2048).SetOOMScoreAdj(500).AddFile("/bin/sh", "/bin/sh", true)
+	if got := sbox.Restore(snap).BuildExecArgs("/bin/true", nil); !reflect.DeepEqual(got, want) {
+		t.Fatalf("restore:\n got: %q\nwant: %q", got, want)
+	}
+
+	sbox.AddEnv("C=3")
+	if got := sbox.Restore(snap).BuildExecArgs("/bin/true", nil); !reflect.DeepEqual(got, want) {
+		t.Fatalf("second restore:\n got: %q\nwant: %q", got, want)
+	}
+}
@@ -0,0 +1,341 @@
+package sandbox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ConfigString renders the sandbox configuration in a stable, human-readable form, one setting per
+// line in sorted order, suitable for golden-file comparison.
+//
+// Unlike CommandLine, it does not include the command. Every setting is rendered, including those
+// that only affect Run, Start or Validate, such as capture limits and policies, so that two
+// configurations render identically only if they behave the same. Secret environment values are
+// redacted, and hooks, tee writers and cleanups are not represented.
+func (s *Sandbox) ConfigString() string {
+	lines := s.configLines()
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// configLines returns the settings rendered by ConfigString, in emission order.
+func (s *Sandbox) configLines() []string {
+	var lines []string
+	add := func(format string, a ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, a...))
+	}
+
+	add("root = %s", s.path)
+
+	if s.configFile != "" {
+		add("config_file = %s", s.configFile)
+	}
+
+	for _, f := range s.files {
+		kind := "file"
+		if f.withLibs {
+			kind = "elf_file"
+		}
+		if f.optional {
+			kind += "_optional"
+		}
+		add("%s = %s -> %s", kind, f.src, f.dst)
+	}
+
+	if s.elfLibDepth != 0 {
+		add("elf_lib_depth = %d", s.elfLibDepth)
+	}
+	if s.libCache != "" {
+		add("lib_cache = %s", s.libCache)
+	}
+	for _, p := range s.libPaths {
+		add("lib_search_path = %s", p)
+	}
+
+	for _, d := range s.mountDirs {
+		kind := "mount_dir"
+		if d.readOnly {
+			kind = "mount_dir_ro"
+		}
+		if d.quota != 0 {
+			add("%s = %s -> %s (quota %d)", kind, d.src, d.dst, d.quota)
+			continue
+		}
+		add("%s = %s -> %s", kind, d.src, d.dst)
+	}
+
+	if s.preserveOrder {
+		add("preserve_insertion_order = true")
+	}
+
+	for _, d := range s.mountDirs {
+		if d.uidMap != "" {
+			add("uid_map = %s %s", d.dst, d.uidMap)
+		}
+		if d.gidMap != "" {
+			add("gid_map = %s %s", d.dst, d.gidMap)
+		}
+	}
+
+	if s.propagation != "" {
+		add("mount_propagation = %s", s.propagation)
+	}
+
+	for _, e := range s.env {
+		add("env = %s", e.render(true))
+	}
+
+	if s.envOverride {
+		add("env_override = true")
+	}
+
+	for _, e := range s.ctxEnv {
+		add("trace_env = %s", e.key)
+	}
+
+	if s.expandEnv {
+		add("expand_env = host:%t strict:%t", s.expandHostEnv, s.expandStrict)
+	}
+
+	for _, e := range s.toolEnv {
+		add("tool_env = %s", e)
+	}
+
+	if s.noNewNet {
+		add("no_new_net = true")
+	}
+	if s.netNS != "" {
+		add("net_ns = %s", s.netNS)
+	}
+	if s.dns {
+		add("dns = true")
+	}
+	if s.namespaces != 0 {
+		add("unshare = %s", s.namespaces)
+	}
+	if s.netBandwidth != 0 {
+		add("net_bandwidth = %d", s.netBandwidth)
+	}
+	if s.cgroup != "" {
+		add("cgroup = %s", s.cgroup)
+	}
+	if s.cpuSet != "" {
+		add("cpuset = %s", s.cpuSet)
+	}
+	if s.nice != nil {
+		add("nice = %d", *s.nice)
+	}
+	if s.memLimit != 0 {
+		add("mem_limit = %d", s.memLimit)
+	}
+	if s.memHigh != 0 {
+		add("mem_high = %d", s.memHigh)
+	}
+	if s.pidsMax != 0 {
+		add("pids_max = %d", s.pidsMax)
+	}
+	for _, r := range s.rlimits {
+		add("rlimit = %s", r)
+	}
+	if s.cpuMaxQuota != 0 {
+		add("cpu_max = %d %d", s.cpuMaxQuota, s.cpuMaxPeriod)
+	}
+	if s.oomScoreAdj != nil {
+		add("oom_score_adj = %d", *s.oomScoreAdj)
+	}
+	if s.capSet != nil {
+		add("cap_bounding_set = %s", strings.Join(s.capSet, ","))
+	}
+	if s.uids != nil {
+		for i, flag := range uidFlags {
+			if s.uids[i] != -1 {
+				add("%s = %d", flag[2:], s.uids[i])
+			}
+		}
+	}
+	if s.coreDumpPath != "" {
+		add("core_dump_path = %s", s.coreDumpPath)
+	}
+	if s.syscallTrace != "" {
+		add("syscall_trace = %s", s.syscallTrace)
+	}
+	if s.lockMemory {
+		add("lock_memory = true")
+	}
+	if s.limitExit != 0 {
+		add("limit_exit_code = %d", s.limitExit)
+	}
+	if s.schedPolicy != "" {
+		add("sched_policy = %s %d", s.schedPolicy, s.schedPriority)
+	}
+	if s.allowRealtime {
+		add("allow_realtime = true")
+	}
+	if s.saveUsageStat != "" {
+		add("save_usage_stat = %s", s.saveUsageStat)
+	}
+	if s.statInterval != 0 {
+		add("usage_stat_interval = %s", s.statInterval)
+	}
+	if s.setupLimit != 0 {
+		add("setup_time_limit = %s", s.setupLimit)
+	}
+	if s.wallLimit != 0 {
+		add("wall_time_limit = %s", s.wallLimit)
+	}
+	if s.limitSignal != 0 {
+		add("time_limit_signal = %d", int(s.limitSignal))
+	}
+	if s.timeOffset != 0 {
+		add("time_offset = %s", s.timeOffset)
+	}
+	if s.execDir != "" {
+		add("exec_dir = %s", s.execDir)
+	}
+	if s.tmpDir != "" {
+		add("tmp_dir = %s", s.tmpDir)
+	}
+	if s.chrootDir != "" {
+		add("chroot_dir = %s", s.chrootDir)
+	}
+	if s.readOnlyRoot {
+		add("read_only_root = true")
+	}
+	for _, w := range s.writable {
+		add("writable = %s", w)
+	}
+	if s.setupCmd != nil {
+		add("setup_command = %s", strings.Join(s.setupCmd, " "))
+	}
+	if s.separator != "" {
+		add("separator = %s", s.separator)
+	}
+	for _, kv := range s.sysctls {
+		add("sysctl = %s=%s", kv[0], kv[1])
+	}
+	for _, l := range s.labels {
+		add("label = %s=%s", l[0], l[1])
+	}
+	if s.killChildren != nil {
+		add("kill_children_on_exit = %t", *s.killChildren)
+	}
+	if s.verbosity != 0 {
+		add("verbosity = %d", s.verbosity)
+	}
+
+	if s.maxCapture > 0 {
+		add("max_capture_bytes = %d", s.maxCapture)
+	}
+	if s.stopCapture {
+		add("stop_on_capture_overflow = true")
+	}
+	if s.diskBudget != 0 {
+		add("writable_disk_budget = %d", s.diskBudget)
+	}
+	if s.newPgrp {
+		add("new_process_group = true")
+	}
+	if s.foreground {
+		add("foreground = true")
+	}
+	if s.allocPTY {
+		add("allocate_pty = true")
+	}
+
+	if s.rejectSymlinks {
+		add("reject_symlink_sources = true")
+	}
+	for _, p := range s.srcPrefixes {
+		add("allowed_source_prefix = %s", p)
+	}
+	for _, p := range s.dstPrefixes {
+		add("allowed_dest_prefix = %s", p)
+	}
+	if s.checkSources {
+		add("check_sources = true")
+	}
+	if s.noNesting {
+		add("no_nesting = true")
+	}
+	if s.strictFlags {
+		add("strict_flags = true")
+	}
+
+	return lines
+}
+
+// describeCategories maps ConfigString keys to Describe categories. Other keys are listed under
+// "Execution".
+var describeCategories = map[string]string{
+	"root": "Filesystem", "config_file": "Filesystem", "file": "Filesystem", "elf_file": "Filesystem",
+	"file_optional": "Filesystem", "elf_file_optional": "Filesystem", "elf_lib_depth": "Filesystem",
+	"lib_cache": "Filesystem", "lib_search_path": "Filesystem", "mount_dir": "Filesystem", "mount_dir_ro": "Filesystem",
+	"mount_propagation": "Filesystem", "uid_map": "Filesystem", "gid_map": "Filesystem", "tmp_dir": "Filesystem", "chroot_dir": "Filesystem",
+	"read_only_root": "Filesystem", "writable": "Filesystem", "preserve_insertion_order": "Filesystem",
+	"reject_symlink_sources": "Filesystem", "allowed_source_prefix": "Filesystem", "allowed_dest_prefix": "Filesystem",
+	"check_sources": "Filesystem", "no_nesting": "Filesystem",
+
+	"env": "Environment", "expand_env": "Environment", "tool_env": "Environment", "env_override": "Environment",
+	"trace_env": "Environment",
+
+	"cgroup": "Limits", "cpuset": "Limits", "nice": "Limits", "mem_limit": "Limits",
+	"mem_high": "Limits", "pids_max": "Limits", "rlimit": "Limits", "cpu_max": "Limits",
+	"oom_score_adj": "Limits", "limit_exit_code": "Limits", "sched_policy": "Limits",
+	"setup_time_limit": "Limits", "wall_time_limit": "Limits", "time_limit_signal": "Limits", "lock_memory": "Limits",
+	"allow_realtime": "Limits", "writable_disk_budget": "Limits",
+
+	"no_new_net": "Isolation", "net_ns": "Isolation", "dns": "Isolation", "unshare": "Isolation",
+	"net_bandwidth": "Isolation", "time_offset": "Isolation", "sysctl": "Isolation",
+	"cap_bounding_set": "Isolation", "ruid": "Isolation", "euid": "Isolation", "suid": "Isolation",
+}
+
+// Describe returns the configuration grouped by category, for display: "Filesystem",
+// "Environment", "Limits", "Isolation" and "Execution". Each category lists its settings in the
+// "key = value" form of ConfigString, in the order the flags are emitted; empty categories are
+// omitted. "Execution" always ends with the command separator, which marks where the sandbox
+// tool flags end and the command begins.
+func (s *Sandbox) Describe() map[string][]string {
+	groups := make(map[string][]string)
+	for _, line := range s.configLines() {
+		key := strings.SplitN(line, " = ", 2)[0]
+
+		category, ok := describeCategories[key]
+		if !ok {
+			category = "Execution"
+		}
+
+		groups[category] = append(groups[category], line)
+	}
+
+	groups["Execution"] = append(groups["Execution"], fmt.Sprintf("command separator = %s", s.separatorToken()))
+
+	return groups
+}
+
+// Hash returns a SHA-256 hex digest of everything that affects how the sandbox tool is invoked:
+// the flags in the order they are emitted, including secret environment values, the setup command,
+// the command separator and the tool environment. It is suitable as a cache key for results.
+//
+// Only host paths are hashed, not the content of the files and directories they refer to, so
+// callers that cache results must also key on the content of the programs and inputs they map.
+// Hooks, tee writers and validation policies are not hashed.
+func (s *Sandbox) Hash() string {
+	h := sha256.New()
+	write := func(section string, values []string) {
+		fmt.Fprintf(h, "%s %d\x00", section, len(values))
+		for _, v := range values {
+			fmt.Fprintf(h, "%s\x00", v)
+		}
+	}
+
+	write("flags", s.buildFlags(false))
+	write("setup", s.setupCmd)
+	write("separator", []string{s.separatorToken()})
+	write("tool_env", s.toolEnv)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,196 @@
+package sandbox_test
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestConfigString(t *testing.T) {
+	a := sandbox.New("/root").
+		AddEnv("B=2").
+		AddEnv("A=1").
+		AddSecretEnv("TOKEN", "s3cr3t").
+		MountDirReadOnly("/data", "/data").
+		SetMemLimit(1024)
+
+	b := sandbox.New("/root").
+		SetMemLimit(1024).
+		MountDirReadOnly("/data", "/data").
+		AddSecretEnv("TOKEN", "other").
+		AddEnv("A=1").
+		AddEnv("B=2")
+
+	want := "env = A=1\n" +
+		"env = B=2\n" +
+		"env = TOKEN=***\n" +
+		"mem_limit = 1024\n" +
+		"mount_dir_ro = /data -> /data\n" +
+		"root = /root\n"
+
+	if got := a.ConfigString(); got != want {
+		t.Fatalf("config string:\n%s\nwant:\n%s", got, want)
+	}
+
+	if a.ConfigString() != b.ConfigString() {
+		t.Fatal("equivalent configurations render differently")
+	}
+}
+
+func TestConfigStringAllFields(t *testing.T) {
+	sbox := fullSandbox().
+		SetPreserveInsertionOrder(true).
+		SetEnvOverride(true).
+		SetTraceEnvFromContext("TRACE_ID", func(context.Context) string { return "" }).
+		SetExpandEnv(true).
+		SetExpandHostEnv(true).
+		SetExpandStrict(true).
+		SetNetNamespace("/run/netns/judge").
+		EnableDNS().
+		SetAllowRealtime(true).
+		SetSetupCommand("true").
+		SetSeparatorToken("---").
+		SetConfigFileMode("/tmp/sandbox.toml").
+		SetMaxCaptureBytes(1024).
+		SetStopOnCaptureOverflow(true).
+		SetWritableDiskBudget(1 << 20).
+		SetToolEnv([]string{"PATH=/bin"}).
+		SetNewProcessGroup(true).
+		SetForeground(true).
+		SetAllocatePTY(true).
+		SetRejectSymlinkSources(true).
+		SetAllowedSourcePrefixes([]string{"/srv"}).
+		SetAllowedDestPrefixes([]string{"/work"}).
+		SetCheckSources(true).
+		SetNoNesting(true).
+		SetStrictFlags(true)
+
+	// The ConfigString key of every Sandbox field. Hooks, tee writers, cleanups and internal
+	// counters are not rendered.
+	exempt := map[string]bool{"mappingSeq": true, "preExec": true, "postExec": true, "stdoutTee": true, "stderrTee": true, "cleanups": true}
+	keys := map[string]string{
+		"path": "root", "files": "file", "elfLibDepth": "elf_lib_depth", "libCache": "lib_cache",
+		"libPaths": "lib_search_path", "mountDirs": "mount_dir", "preserveOrder": "preserve_insertion_order",
+		"propagation": "mount_propagation", "env": "env", "envOverride": "env_override", "ctxEnv": "trace_env",
+		"expandEnv": "expand_env", "expandHostEnv": "expand_env", "expandStrict": "expand_env",
+		"noNewNet": "no_new_net", "netNS": "net_ns", "dns": "dns", "namespaces": "unshare",
+		"netBandwidth": "net_bandwidth", "cgroup": "cgroup", "cpuSet": "cpuset", "nice": "nice",
+		"memLimit": "mem_limit", "memHigh": "mem_high", "pidsMax": "pids_max", "rlimits": "rlimit",
+		"cpuMaxQuota": "cpu_max", "cpuMaxPeriod": "cpu_max", "oomScoreAdj": "oom_score_adj", "uids": "ruid",
+		"capSet": "cap_bounding_set", "coreDumpPath": "core_dump_path", "syscallTrace": "syscall_trace",
+		"lockMemory": "lock_memory", "limitExit": "limit_exit_code", "schedPolicy": "sched_policy",
+		"schedPriority": "sched_policy", "allowRealtime": "allow_realtime", "saveUsageStat": "save_usage_stat",
+		"statInterval": "usage_stat_interval", "setupLimit": "setup_time_limit", "wallLimit": "wall_time_limit",
+		"limitSignal": "time_limit_signal", "timeOffset": "time_offset", "execDir": "exec_dir",
+		"tmpDir": "tmp_dir", "chrootDir": "chroot_dir", "readOnlyRoot": "read_only_root", "writable": "writable",
+		"killChildren": "kill_children_on_exit", "verbosity": "verbosity", "setupCmd": "setup_command",
+		"separator": "separator", "configFile": "config_file", "labels": "label", "sysctls": "sysctl",
+		"maxCapture": "max_capture_bytes", "diskBudget": "writable_disk_budget",
+		"stopCapture": "stop_on_capture_overflow", "toolEnv": "tool_env", "newPgrp": "new_process_group",
+		"foreground": "foreground", "allocPTY": "allocate_pty", "rejectSymlinks": "reject_symlink_sources",
+		"srcPrefixes": "allowed_source_prefix", "dstPrefixes": "allowed_dest_prefix",
+		"checkSources": "check_sources", "noNesting": "no_nesting", "strictFlags": "strict_flags",
+	}
+
+	config := "\n" + sbox.ConfigString()
+	v := reflect.ValueOf(sbox).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if exempt[name] {
+			continue
+		}
+
+		key, ok := keys[name]
+		switch {
+		case !ok:
+			t.Errorf("field %s has no ConfigString key; render it and list it here", name)
+		case v.Field(i).IsZero():
+			t.Errorf("field %s is not set by the test configuration", name)
+		case !strings.Contains(config, "\n"+key+" = "):
+			t.Errorf("field %s is not rendered as %s", name, key)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	build := func() *sandbox.Sandbox {
+		return sandbox.New("/root").MountDir("/data", "/data").AddSecretEnv("TOKEN", "a").SetMemLimit(1024)
+	}
+
+	if a, b := build().Hash(), build().Hash(); a != b || len(a) != 64 {
+		t.Fatalf("unstable hash: %s, %s", a, b)
+	}
+
+	base := build().Hash()
+	for name, sbox := range map[string]*sandbox.Sandbox{
+		"secret":   sandbox.New("/root").MountDir("/data", "/data").AddSecretEnv("TOKEN", "b").SetMemLimit(1024),
+		"limit":    build().SetMemLimit(2048),
+		"setup":    build().SetSetupCommand("true"),
+		"tool_env": build().SetToolEnv([]string{"A=1"}),
+	} {
+		if sbox.Hash() == base {
+			t.Fatalf("%s change does not affect the hash", name)
+		}
+	}
+}
+
+func TestConfigFileMode(t *testing.T) {
+	sbox := sandbox.New("/root").
+		AddFile("/bin/sh", "/bin/sh", true).
+		AddEnv(`MSG="hi"\there`).
+		SetMemLimit(1024).
+		SetConfigFileMode("/tmp/sandbox.toml")
+
+	want := []string{"/root", "--config", "/tmp/sandbox.toml", "--", "/bin/true"}
+	if got := sbox.BuildExecArgs("/bin/true", nil); !reflect.DeepEqual(got, want) {
+		t.Fatalf("args:\n got: %q\nwant: %q", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := sbox.WriteConfigFile(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	wantFile := "[[flag]]\nname = \"add_elf_file\"\nargs = [\"/bin/sh\", \"/bin/sh\"]\n\n" +
+		"[[flag]]\nname = \"env\"\nargs = [\"MSG=\\\"hi\\\"\\\\there\"]\n\n" +
+		"[[flag]]\nname = \"mem_limit\"\nargs = [\"1024\"]\n\n"
+	if buf.String() != wantFile {
+		t.Fatalf("config file:\n got: %s\nwant: %s", buf.String(), wantFile)
+	}
+
+	buf.Reset()
+	if err := sandbox.New("/root").AddEnv("--foo").SetNoNewNet(true).WriteConfigFile(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	wantFile = "[[flag]]\nname = \"env\"\nargs = [\"--foo\"]\n\n" +
+		"[[flag]]\nname = \"no_new_net\"\nargs = []\n\n"
+	if buf.String() != wantFile {
+		t.Fatalf("config file with a flag-like value:\n got: %s\nwant: %s", buf.String(), wantFile)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	got := sandbox.New("/root").
+		MountDir("/data", "/data").
+		AddSecretEnv("TOKEN", "s3cr3t").
+		SetMemLimit(1024).
+		SetNoNewNet(true).
+		SetLabel("run", "1").
+		Describe()
+
+	want := map[string][]string{
+		"Filesystem":  {"root = /root", "mount_dir = /data -> /data"},
+		"Environment": {"env = TOKEN=***"},
+		"Limits":      {"mem_limit = 1024"},
+		"Isolation":   {"no_new_net = true"},
+		"Execution":   {"label = run=1", "command separator = --"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Describe():\n got: %q\nwant: %q", got, want)
+	}
+}
@@ -0,0 +1,70 @@
+package sandbox
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SetConfigFileMode makes the commands pass the configuration to the sandbox tool as a config
+// file, with --config path, instead of as inline flags, which avoids hitting the argument length
+// limit with long file lists. An empty path restores inline flags.
+//
+// The caller must write the file with WriteConfigFile before running the command, and again
+// after changing the configuration. The --config flag requires a sandbox tool version that
+// supports config files; check with SupportsFlag("--config").
+func (s *Sandbox) SetConfigFileMode(path string) *Sandbox {
+	s.configFile = path
+
+	return s
+}
+
+// WriteConfigFile writes the configuration flags, without the sandbox root, in the TOML format
+// read by the sandbox tool --config flag. Every flag becomes a [[flag]] table with the flag name,
+// without the leading dashes, and its arguments, in the order they would be passed inline.
+func (s *Sandbox) WriteConfigFile(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range splitFlags(s.buildFlags(false)[1:]) {
+		quoted := make([]string, len(f)-1)
+		for i, a := range f[1:] {
+			quoted[i] = tomlQuote(a)
+		}
+
+		fmt.Fprintf(bw, "[[flag]]\nname = %s\nargs = [%s]\n\n",
+			tomlQuote(strings.TrimPrefix(f[0], "--")), strings.Join(quoted, ", "))
+	}
+
+	return bw.Flush()
+}
+
+// flagArgs returns the sandbox root followed by either the configuration flags or, with
+// SetConfigFileMode, the --config flag.
+func (s *Sandbox) flagArgs(redact bool) []string {
+	if s.configFile != "" {
+		return []string{s.path, "--config", s.configFile}
+	}
+
+	return s.buildFlags(redact)
+}
+
+// tomlQuote renders v as a TOML basic string.
+func tomlQuote(v string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range v {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package sandbox
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CpuRange returns a cpuset string, suitable for SetCpuSet, that selects count consecutive CPUs
+// starting at start: CpuRange(4, 4) is "4-7". It returns an empty string if count is not positive or
+// start is negative.
+func CpuRange(start, count int) string {
+	if count <= 0 || start < 0 {
+		return ""
+	}
+
+	if count == 1 {
+		return strconv.Itoa(start)
+	}
+
+	return strconv.Itoa(start) + "-" + strconv.Itoa(start+count-1)
+}
+
+// cpuSetSize returns the number of distinct CPUs selected by a cpuset string in the cpuset(7) list
+// format, such as "0-3,8,10-11".
+func cpuSetSize(set string) (int, error) {
+	var ranges [][2]int
+
+	for _, part := range strings.Split(set, ",") {
+		lo, hi := part, part
+		if i := strings.IndexByte(part, '-'); i >= 0 {
+			lo, hi = part[:i], part[i+1:]
+		}
+
+		start, err := strconv.Atoi(lo)
+		if err != nil || start < 0 {
+			return 0, fmt.Errorf("sandbox: invalid cpuset %q", set)
+		}
+		end, err := strconv.Atoi(hi)
+		if err != nil || end < start {
+			return 0, fmt.Errorf("sandbox: invalid cpuset %q", set)
+		}
+
+		ranges = append(ranges, [2]int{start, end})
+	}
+
+	// Ranges may overlap, so they are merged rather than enumerated, which would take time
+	// proportional to the CPU ids.
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	n, next := 0, 0
+	for _, r := range ranges {
+		if r[0] < next {
+			r[0] = next
+		}
+		if r[1] >= r[0] {
+			n += r[1] - r[0] + 1
+			next = r[1] + 1
+		}
+	}
+
+	return n, nil
+}
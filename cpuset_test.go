@@ -0,0 +1,53 @@
+package sandbox_test
+
+import (
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestCpuRange(t *testing.T) {
+	for _, tc := range []struct {
+		start, count int
+		want         string
+	}{
+		{4, 4, "4-7"},
+		{0, 1, "0"},
+		{2, 0, ""},
+		{2, -1, ""},
+		{-1, 2, ""},
+	} {
+		if got := sandbox.CpuRange(tc.start, tc.count); got != tc.want {
+			t.Errorf("CpuRange(%d, %d) = %q, want %q", tc.start, tc.count, got, tc.want)
+		}
+	}
+}
+
+func TestResourceRequest(t *testing.T) {
+	req := sandbox.New("/root").
+		SetMemLimit(256<<20).
+		SetCpuSet("0-3,8,2-5").
+		SetRlimit("nproc", 32).
+		ResourceRequest()
+
+	want := sandbox.ResourceRequest{MemLimit: 256 << 20, CPUs: 7, PidsLimit: 32}
+	if req != want {
+		t.Fatalf("ResourceRequest() = %+v, want %+v", req, want)
+	}
+
+	if req := sandbox.New("/root").SetCpuSet("0-2000000000,5-10,1999999999-2000000001").ResourceRequest(); req.CPUs != 2000000002 {
+		t.Fatalf("CPUs of a huge cpuset: %d", req.CPUs)
+	}
+
+	if req := sandbox.New("/root").SetRlimit("nproc", 32).SetPidLimit(16).ResourceRequest(); req.PidsLimit != 16 {
+		t.Fatalf("SetPidLimit not preferred over nproc: %+v", req)
+	}
+
+	if err := sandbox.New("/root").SetCpuSet("3-1").Validate(); err == nil {
+		t.Fatal("expected error for invalid cpuset")
+	}
+
+	if req := sandbox.New("/root").ResourceRequest(); req != (sandbox.ResourceRequest{}) {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+}
@@ -0,0 +1,38 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// DevMode lets commands run WITHOUT ANY ISOLATION when the sandbox tool is not installed, so that
+// code using this package can be developed on machines without it. It only takes effect if the
+// LIBSANDBOX_DEV_MODE environment variable is also set to 1, so that a binary built with DevMode
+// enabled still fails on a host where the variable is not set.
+//
+// When it takes effect, CommandContext, and therefore Run and Start, execute path with args
+// directly on the host, ignoring the whole configuration, and log a warning for every command.
+// NEVER enable it in production: the program can read, modify and delete anything the current
+// user can.
+var DevMode bool
+
+// devModeCmd returns a command that runs path directly on the host if dev mode is in effect and
+// the sandbox tool is missing, or nil otherwise.
+func devModeCmd(ctx context.Context, path string, args []string) *exec.Cmd {
+	if !DevMode || os.Getenv("LIBSANDBOX_DEV_MODE") != "1" {
+		return nil
+	}
+
+	if _, err := exec.LookPath(Path); err == nil {
+		return nil
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	warnf("DEV MODE: %s is missing, running %s WITHOUT ISOLATION", Path, path)
+
+	return execCommandContext(ctx, path, args...)
+}
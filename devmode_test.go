@@ -0,0 +1,36 @@
+package sandbox_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestDevMode(t *testing.T) {
+	withToolPath(t, filepath.Join(t.TempDir(), "missing"))
+
+	var warnings []string
+	prev := sandbox.Warnf
+	sandbox.Warnf = func(format string, args ...interface{}) { warnings = append(warnings, format) }
+	defer func() { sandbox.Warnf = prev }()
+
+	sandbox.DevMode = true
+	defer func() { sandbox.DevMode = false }()
+
+	t.Setenv("LIBSANDBOX_DEV_MODE", "")
+	if cmd := sandbox.New("/root").Command("/bin/echo", "hi"); cmd.Args[0] == "/bin/echo" {
+		t.Fatalf("dev mode used without the environment variable: %q", cmd.Args)
+	}
+
+	t.Setenv("LIBSANDBOX_DEV_MODE", "1")
+	res, err := sandbox.New("/root").SetMemLimit(1).Run(context.Background(), "/bin/echo", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(res.Stdout) != "hi\n" || len(warnings) != 1 {
+		t.Fatalf("stdout %q, warnings %q", res.Stdout, warnings)
+	}
+}
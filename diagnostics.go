@@ -0,0 +1,62 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// diagnosticVerbosity is the SetVerbosity level of the runs made by RunWithDiagnosticsOnFailure.
+const diagnosticVerbosity = 2
+
+// Diagnostics holds what RunWithDiagnosticsOnFailure captured by running a failed command again.
+type Diagnostics struct {
+	// CommandLine is the sandbox tool invocation of the diagnostic run, see CommandLine.
+	CommandLine string
+	// Result is the outcome of the diagnostic run; its Stderr holds the verbose tool output. It is
+	// nil if the diagnostic run could not be prepared.
+	Result *Result
+	// Err is the error of the diagnostic run, if any.
+	Err error
+	// SyscallTrace is the system call trace of the diagnostic run, see SetSyscallTrace, or nil if
+	// the tool did not write one.
+	SyscallTrace []byte
+}
+
+// RunWithDiagnosticsOnFailure is identical to Run, but if the command fails, that is if Run returns
+// an error or a non-zero exit code, it runs the command once more on a clone of the configuration
+// with verbose tool output and system call tracing enabled, and returns what that run captured. The
+// Result and error are those of the first run; Diagnostics is nil if it succeeded, or if a second
+// run would be pointless because the configuration is invalid or ctx is already done.
+//
+// The command runs twice, so it must be safe to repeat. Cleanups registered with AddCleanup run
+// after the first run and are not repeated, so resources they release are gone for the second one.
+// Tracing slows the program down, so the diagnostic run may fail differently, e.g. by exceeding a
+// time limit. Hooks and tee writers see both runs.
+func (s *Sandbox) RunWithDiagnosticsOnFailure(ctx context.Context, path string, args ...string) (*Result, *Diagnostics, error) {
+	res, err := s.Run(ctx, path, args...)
+	var cfgErr *ConfigError
+	if (err == nil && res.ExitCode == 0) || errors.As(err, &cfgErr) || (ctx != nil && ctx.Err() != nil) {
+		return res, nil, err
+	}
+
+	diag := &Diagnostics{}
+
+	trace, traceErr := os.CreateTemp("", "sandbox-trace-")
+	if traceErr != nil {
+		diag.Err = traceErr
+		return res, diag, err
+	}
+	trace.Close()
+	defer os.Remove(trace.Name())
+
+	c := s.Clone().SetVerbosity(diagnosticVerbosity).SetSyscallTrace(trace.Name())
+	diag.CommandLine = c.CommandLine(path, args...)
+	diag.Result, diag.Err = c.Run(ctx, path, args...)
+
+	if data, readErr := os.ReadFile(trace.Name()); readErr == nil && len(data) != 0 {
+		diag.SyscallTrace = data
+	}
+
+	return res, diag, err
+}
@@ -0,0 +1,50 @@
+package sandbox_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestRunWithDiagnosticsOnFailure(t *testing.T) {
+	// The fake tool fails, writes a trace if asked to and reports its verbosity on stderr.
+	script := writeFile(t, "tool.sh", `#!/bin/sh
+while [ "$1" != "--" ]; do
+	case "$1" in
+	--syscall_trace) echo "execve(...)" > "$2" ;;
+	--verbosity) echo "verbosity $2" >&2 ;;
+	esac
+	shift
+done
+exit 1
+`)
+	if err := os.Chmod(script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	withToolPath(t, script)
+
+	res, diag, err := sandbox.New("/root").RunWithDiagnosticsOnFailure(context.Background(), "/bin/prog")
+	if err == nil || res.ExitCode != 1 || len(res.Stderr) != 0 {
+		t.Fatalf("unexpected first run: %v, %+v", err, res)
+	}
+	if diag == nil {
+		t.Fatal("no diagnostics")
+	}
+	if got := string(diag.Result.Stderr); got != "verbosity 2\n" {
+		t.Fatalf("diagnostic stderr: %q", got)
+	}
+	if got := string(diag.SyscallTrace); got != "execve(...)\n" {
+		t.Fatalf("syscall trace: %q", got)
+	}
+	if diag.Err == nil || !strings.Contains(diag.CommandLine, "--syscall_trace") {
+		t.Fatalf("unexpected diagnostics: %+v", diag)
+	}
+
+	withToolPath(t, "/bin/true")
+	if _, diag, err := sandbox.New("/root").RunWithDiagnosticsOnFailure(context.Background(), "/bin/prog"); err != nil || diag != nil {
+		t.Fatalf("unexpected diagnostics for a successful run: %v, %+v", err, diag)
+	}
+}
@@ -0,0 +1,77 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrDiskBudgetExceeded is returned by Run when the writable mounts hold more data after the run
+// than allowed by SetWritableDiskBudget.
+var ErrDiskBudgetExceeded = errors.New("sandbox: writable disk budget exceeded")
+
+// SetWritableDiskBudget bounds the combined size of all writable directory mounts, those added
+// without a read-only option, and of the host directory of SetTmpDir to maxBytes. Zero, the
+// default, means no budget.
+//
+// The budget is enforced by Run, not by the sandbox tool: once the command has exited, Run sums
+// the sizes of the regular files under the host sources of the writable mounts, including any data
+// they held before the run, and returns ErrDiskBudgetExceeded if the total is above maxBytes. The
+// check runs whether or not the command succeeded; after a failed run, the error matches both
+// ErrDiskBudgetExceeded and the run error with errors.Is and errors.As. It is a post-hoc check, so
+// it cannot stop a program from filling the disk while it runs; use MountDirQuota for that where
+// the host filesystem supports it. Commands built by CommandContext are not checked.
+func (s *Sandbox) SetWritableDiskBudget(maxBytes uint64) *Sandbox {
+	s.diskBudget = maxBytes
+
+	return s
+}
+
+// checkDiskBudget returns ErrDiskBudgetExceeded, wrapped, if the writable mounts are larger than
+// the budget set by SetWritableDiskBudget.
+func (s *Sandbox) checkDiskBudget() error {
+	if s.diskBudget == 0 {
+		return nil
+	}
+
+	var dirs []string
+	for _, d := range s.mountDirs {
+		if !d.readOnly {
+			dirs = append(dirs, d.src)
+		}
+	}
+	if s.tmpDir != "" {
+		dirs = append(dirs, s.tmpDir)
+	}
+
+	seen := make(map[string]bool)
+
+	var used uint64
+	for _, dir := range dirs {
+		src := filepath.Clean(dir)
+		if seen[src] {
+			continue
+		}
+		seen[src] = true
+
+		err := filepath.Walk(src, func(_ string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.Mode().IsRegular() {
+				used += uint64(fi.Size())
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("sandbox: measure writable mount %s: %w", dir, err)
+		}
+	}
+
+	if used > s.diskBudget {
+		return fmt.Errorf("%w: writable mounts hold %d bytes, budget is %d", ErrDiskBudgetExceeded, used, s.diskBudget)
+	}
+
+	return nil
+}
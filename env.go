@@ -0,0 +1,322 @@
+package sandbox
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AddEnvFile adds environment variables read from a dotenv file.
+//
+// Each non-empty line that does not start with '#' must have the form KEY=VALUE, optionally
+// prefixed with "export ", where KEY is a valid name, see AddEnvKVE. Values may be double-quoted,
+// in which case \n, \t, \", \\ and \$ escapes are interpreted, or single-quoted, in which case
+// they are taken literally. Unquoted values are trimmed and may be followed by a " #" comment.
+// Nothing is added if the file contains an error.
+func (s *Sandbox) AddEnvFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var kvs [][2]string
+
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		key, value, err := parseDotenvLine(line)
+		if err != nil {
+			return fmt.Errorf("sandbox: %s:%d: %w", path, n, err)
+		}
+
+		kvs = append(kvs, [2]string{key, value})
+	}
+
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	for _, kv := range kvs {
+		s.AddEnvKV(kv[0], kv[1])
+	}
+
+	return nil
+}
+
+// AddEnvKVE is identical to AddEnvKV, but fails without adding anything if key is not a valid
+// POSIX environment variable name: letters, digits and underscores, not starting with a digit.
+// AddEnv and AddEnvKV accept any name.
+func (s *Sandbox) AddEnvKVE(key, value string) error {
+	if !validEnvName(key) {
+		return fmt.Errorf("sandbox: invalid environment variable name %q", key)
+	}
+
+	s.AddEnvKV(key, value)
+
+	return nil
+}
+
+// AddEnvFromFile adds a secret environment variable, as with AddSecretEnv, whose value is the
+// content of the host file path, such as a mounted secret. A single trailing newline is trimmed.
+//
+// The file is read when AddEnvFromFile is called; nothing is added if it cannot be read or if key
+// is not a valid name, see AddEnvKVE.
+func (s *Sandbox) AddEnvFromFile(key, path string) error {
+	if !validEnvName(key) {
+		return fmt.Errorf("sandbox: invalid environment variable name %q", key)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	value := strings.TrimSuffix(string(data), "\n")
+	value = strings.TrimSuffix(value, "\r")
+	s.AddSecretEnv(key, value)
+
+	return nil
+}
+
+// SetTimezone sets the TZ environment variable of the sandboxed process, e.g. to "Europe/Berlin"
+// or "UTC".
+//
+// The C library resolves zone names through the zoneinfo database, so /usr/share/zoneinfo must
+// exist in the sandbox root; otherwise programs silently fall back to UTC. If the root lacks it,
+// mount it with MountDirReadOnly("/usr/share/zoneinfo", "/usr/share/zoneinfo").
+func (s *Sandbox) SetTimezone(tz string) *Sandbox {
+	return s.AddEnvKV("TZ", tz)
+}
+
+// SetLocale sets both the LANG and LC_ALL environment variables of the sandboxed process, e.g. to
+// "C.UTF-8". Other than the C and POSIX locales, the locale data must exist in the sandbox root.
+func (s *Sandbox) SetLocale(locale string) *Sandbox {
+	return s.AddEnvKV("LANG", locale).AddEnvKV("LC_ALL", locale)
+}
+
+// ctxEnvVar is an environment variable whose value is extracted from the command context.
+type ctxEnvVar struct {
+	key     string
+	extract func(context.Context) string
+}
+
+// SetTraceEnvFromContext adds an environment variable whose value is taken from the context of
+// each command, such as a trace ID, when the command is constructed with a context, such as by
+// CommandContext, CommandArgv0, CommandFD, Run or Start. The variable is skipped if extract
+// returns an empty string, and for commands built without a context, such as by Command or
+// BuildExecArgs.
+func (s *Sandbox) SetTraceEnvFromContext(key string, extract func(context.Context) string) *Sandbox {
+	s.ctxEnv = append(s.ctxEnv, ctxEnvVar{key: key, extract: extract})
+
+	return s
+}
+
+// contextEnvFlags returns the --env flags for the variables added by SetTraceEnvFromContext.
+func (s *Sandbox) contextEnvFlags(ctx context.Context) []string {
+	var flags []string
+	for _, e := range s.ctxEnv {
+		if v := e.extract(ctx); v != "" {
+			flags = append(flags, "--env", e.key+"="+v)
+		}
+	}
+
+	return flags
+}
+
+// InheritEnvExcept copies the environment of the current process into the sandbox, skipping the
+// variables whose keys are listed in denyKeys. Keys are matched exactly, as environment variable
+// names are case-sensitive.
+//
+// The environment is captured when InheritEnvExcept is called, not when the command is built.
+func (s *Sandbox) InheritEnvExcept(denyKeys ...string) *Sandbox {
+	deny := make(map[string]bool, len(denyKeys))
+	for _, k := range denyKeys {
+		deny[k] = true
+	}
+
+	for _, e := range os.Environ() {
+		if !deny[strings.SplitN(e, "=", 2)[0]] {
+			s.AddEnv(e)
+		}
+	}
+
+	return s
+}
+
+// SetExpandEnv enables expansion of $VAR and ${VAR} references in environment values when the
+// command is built.
+//
+// A reference in an entry resolves to the value of the latest entry with that key added before
+// it, after that entry's own expansion. If there is none, the current process environment is
+// consulted when SetExpandHostEnv(true) is set. Anything else expands to an empty string, or makes
+// Validate fail when SetExpandStrict(true) is set. Keys are never expanded.
+//
+// Secret values referenced by other variables are not redacted in those variables.
+func (s *Sandbox) SetExpandEnv(v bool) *Sandbox {
+	s.expandEnv = v
+
+	return s
+}
+
+// SetExpandHostEnv makes SetExpandEnv fall back to the current process environment.
+func (s *Sandbox) SetExpandHostEnv(v bool) *Sandbox {
+	s.expandHostEnv = v
+
+	return s
+}
+
+// SetExpandStrict makes Validate fail if SetExpandEnv meets a variable it cannot resolve.
+func (s *Sandbox) SetExpandStrict(v bool) *Sandbox {
+	s.expandStrict = v
+
+	return s
+}
+
+// resolvedEnv returns the environment as passed to the tool, with references expanded if enabled,
+// and the names of the variables that could not be resolved.
+func (s *Sandbox) resolvedEnv() ([]envVar, []string) {
+	if !s.expandEnv {
+		return s.env, nil
+	}
+
+	var unresolved []string
+	seen := make(map[string]string, len(s.env))
+	env := make([]envVar, len(s.env))
+
+	for i, e := range s.env {
+		kv := strings.SplitN(e.value, "=", 2)
+		if len(kv) == 2 {
+			kv[1] = os.Expand(kv[1], func(name string) string {
+				if v, ok := seen[name]; ok {
+					return v
+				}
+
+				if s.expandHostEnv {
+					if v, ok := os.LookupEnv(name); ok {
+						return v
+					}
+				}
+
+				unresolved = append(unresolved, name)
+				return ""
+			})
+			seen[kv[0]] = kv[1]
+		}
+
+		env[i] = envVar{value: strings.Join(kv, "="), secret: e.secret}
+	}
+
+	return env, unresolved
+}
+
+func (s *Sandbox) validateEnv() error {
+	if !s.expandStrict {
+		return nil
+	}
+
+	if _, unresolved := s.resolvedEnv(); len(unresolved) != 0 {
+		return configErr("env", -1, nil, "unresolved variables: %s", strings.Join(unresolved, ", "))
+	}
+
+	return nil
+}
+
+// validEnvName reports whether key matches [A-Za-z_][A-Za-z0-9_]*.
+func validEnvName(key string) bool {
+	for i, r := range key {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return key != ""
+}
+
+func parseDotenvLine(line string) (string, string, error) {
+	line = strings.TrimPrefix(line, "export ")
+
+	eq := strings.IndexByte(line, '=')
+	if eq < 0 {
+		return "", "", fmt.Errorf("missing '=' in %q", line)
+	}
+
+	key := strings.TrimSpace(line[:eq])
+	if !validEnvName(key) {
+		return "", "", fmt.Errorf("invalid key %q", key)
+	}
+
+	raw := strings.TrimSpace(line[eq+1:])
+	if raw == "" {
+		return key, "", nil
+	}
+
+	switch raw[0] {
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated single quote in value of %s", key)
+		}
+
+		if err := checkTrailing(key, raw[end+2:]); err != nil {
+			return "", "", err
+		}
+
+		return key, raw[1 : end+1], nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			switch {
+			case c == '"':
+				if err := checkTrailing(key, raw[i+1:]); err != nil {
+					return "", "", err
+				}
+
+				return key, b.String(), nil
+			case c == '\\' && i+1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case '"', '\\', '$':
+					b.WriteByte(raw[i])
+				default:
+					b.WriteByte('\\')
+					b.WriteByte(raw[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+
+		return "", "", fmt.Errorf("unterminated double quote in value of %s", key)
+	}
+
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+
+	return key, raw, nil
+}
+
+// checkTrailing verifies that only whitespace or a comment follows a quoted value.
+func checkTrailing(key, rest string) error {
+	rest = strings.TrimSpace(rest)
+	if rest != "" && rest[0] != '#' {
+		return fmt.Errorf("unexpected characters after quoted value of %s", key)
+	}
+
+	return nil
+}
@@ -0,0 +1,247 @@
+package sandbox_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// envArgs returns the values of all --env flags emitted for sbox.
+func envArgs(sbox *sandbox.Sandbox) []string {
+	var env []string
+
+	args := sbox.BuildExecArgs("/bin/true", nil)
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "--" {
+			break
+		}
+
+		if args[i] == "--env" {
+			env = append(env, args[i+1])
+			i++
+		}
+	}
+
+	return env
+}
+
+func TestAddEnvFile(t *testing.T) {
+	path := writeFile(t, ".env", strings.Join([]string{
+		"# comment",
+		"",
+		"PLAIN=value # trailing comment",
+		"export EXPORTED=1",
+		`DOUBLE="line\nbreak \"quoted\""`,
+		`SINGLE='no $escape\n'`,
+		"EMPTY=",
+	}, "\n"))
+
+	sbox := sandbox.New("/root")
+	if err := sbox.AddEnvFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"PLAIN=value",
+		"EXPORTED=1",
+		"DOUBLE=line\nbreak \"quoted\"",
+		`SINGLE=no $escape\n`,
+		"EMPTY=",
+	}
+	if got := envArgs(sbox); !reflect.DeepEqual(got, want) {
+		t.Fatalf("env:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestAddEnvFileMalformed(t *testing.T) {
+	path := writeFile(t, ".env", "GOOD=1\nBAD LINE\n")
+
+	sbox := sandbox.New("/root")
+
+	err := sbox.AddEnvFile(path)
+	if err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Fatalf("expected error on line 2, got %v", err)
+	}
+
+	if env := envArgs(sbox); len(env) != 0 {
+		t.Fatalf("env added despite error: %q", env)
+	}
+}
+
+func TestInheritEnvExcept(t *testing.T) {
+	t.Setenv("LIBSANDBOX_KEEP", "1")
+	t.Setenv("LIBSANDBOX_SECRET", "2")
+
+	env := envArgs(sandbox.New("/root").InheritEnvExcept("LIBSANDBOX_SECRET"))
+
+	var keep, secret bool
+	for _, e := range env {
+		keep = keep || e == "LIBSANDBOX_KEEP=1"
+		secret = secret || strings.HasPrefix(e, "LIBSANDBOX_SECRET=")
+	}
+
+	if !keep || secret {
+		t.Fatalf("inherited env: %q", env)
+	}
+}
+
+func TestSetExpandEnv(t *testing.T) {
+	t.Setenv("LIBSANDBOX_HOST", "/host/bin")
+
+	sbox := sandbox.New("/root").
+		AddEnv("PATH=/usr/bin").
+		AddEnv("PATH=$PATH:/opt/bin").
+		AddEnv("LIB=${PATH}/../lib").
+		AddEnv("HOST=$LIBSANDBOX_HOST").
+		SetExpandEnv(true)
+
+	want := []string{"PATH=/usr/bin", "PATH=/usr/bin:/opt/bin", "LIB=/usr/bin:/opt/bin/../lib", "HOST="}
+	if got := envArgs(sbox); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expanded env:\n got: %q\nwant: %q", got, want)
+	}
+
+	if err := sbox.SetExpandStrict(true).Validate(); err == nil || !strings.Contains(err.Error(), "LIBSANDBOX_HOST") {
+		t.Fatalf("expected unresolved variable error, got %v", err)
+	}
+
+	sbox.SetExpandHostEnv(true)
+	if err := sbox.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := envArgs(sbox); got[3] != "HOST=/host/bin" {
+		t.Fatalf("host env not used: %q", got)
+	}
+
+	if got := envArgs(sbox.SetExpandEnv(false)); got[1] != "PATH=$PATH:/opt/bin" {
+		t.Fatalf("env expanded while disabled: %q", got)
+	}
+}
+
+func TestAddEnvFromFile(t *testing.T) {
+	sbox := sandbox.New("/root")
+
+	for _, content := range []string{"s3cret\n", "s3cret\r\n", "s3cret"} {
+		if err := sbox.AddEnvFromFile("TOKEN", writeFile(t, "token", content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sbox.AddEnvFromFile("MULTI", writeFile(t, "multi", "a\nb\n\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"TOKEN=s3cret", "TOKEN=s3cret", "TOKEN=s3cret", "MULTI=a\nb\n"}
+	if got := envArgs(sbox); !reflect.DeepEqual(got, want) {
+		t.Fatalf("env:\n got: %q\nwant: %q", got, want)
+	}
+
+	if strings.Contains(sbox.CommandLine("/bin/true"), "s3cret") {
+		t.Fatal("secret value is not redacted")
+	}
+
+	if err := sbox.AddEnvFromFile("MISSING", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
+
+func TestSetTimezoneAndLocale(t *testing.T) {
+	sbox := sandbox.New("/root").SetTimezone("Europe/Berlin").SetLocale("C.UTF-8")
+
+	want := []string{"TZ=Europe/Berlin", "LANG=C.UTF-8", "LC_ALL=C.UTF-8"}
+	if got := envArgs(sbox); !reflect.DeepEqual(got, want) {
+		t.Fatalf("env:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+type traceKey struct{}
+
+func TestSetTraceEnvFromContext(t *testing.T) {
+	sbox := sandbox.New("/root").SetTraceEnvFromContext("TRACE_ID", func(ctx context.Context) string {
+		id, _ := ctx.Value(traceKey{}).(string)
+		return id
+	})
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "abc123")
+	for _, cmd := range []*exec.Cmd{
+		sbox.CommandContext(ctx, "/bin/true"),
+		sbox.CommandArgv0(ctx, "/bin/busybox", "true"),
+		sbox.CommandFD(ctx, os.Stdin),
+	} {
+		if !hasArgs(cmd.Args, "/root", "--env", "TRACE_ID=abc123") {
+			t.Fatalf("missing trace env: %q", cmd.Args)
+		}
+	}
+
+	for _, cmd := range []*exec.Cmd{sbox.CommandContext(context.Background(), "/bin/true"), sbox.Command("/bin/true")} {
+		if hasArgs(cmd.Args, "--env") {
+			t.Fatalf("unexpected env: %q", cmd.Args)
+		}
+	}
+}
+
+func TestSetEnvOverride(t *testing.T) {
+	sbox := sandbox.New("/root").AddEnv("A=1").AddEnv("A=2")
+	if got := envArgs(sbox); !reflect.DeepEqual(got, []string{"A=1", "A=2"}) {
+		t.Fatalf("default env: %q", got)
+	}
+
+	sbox = sandbox.New("/root").SetEnvOverride(true).
+		AddEnv("A=1").
+		AddEnvKV("B", "1").
+		AddEnvKV("A", "2").
+		AddSecretEnv("B", "s3cret").
+		AddEnv("A=3")
+
+	want := []string{"A=3", "B=s3cret"}
+	if got := envArgs(sbox); !reflect.DeepEqual(got, want) {
+		t.Fatalf("env:\n got: %q\nwant: %q", got, want)
+	}
+
+	if strings.Contains(sbox.CommandLine("/bin/true"), "s3cret") {
+		t.Fatal("overriding secret value is not redacted")
+	}
+
+	sbox = sandbox.New("/root").AddEnv("A=1").AddEnv("B=1").AddEnv("A=2").SetEnvOverride(true).AddEnv("A=3")
+	if got := envArgs(sbox); !reflect.DeepEqual(got, []string{"A=3", "B=1"}) {
+		t.Fatalf("env with earlier duplicates: %q", got)
+	}
+}
+
+func TestAddEnvKVE(t *testing.T) {
+	sbox := sandbox.New("/root")
+	for _, key := range []string{"A", "_x", "PATH_2", "lower"} {
+		if err := sbox.AddEnvKVE(key, "1"); err != nil {
+			t.Fatalf("%q: %v", key, err)
+		}
+	}
+
+	for _, key := range []string{"", "2FA", "A-B", "A.B", "A B", "Ä"} {
+		if err := sbox.AddEnvKVE(key, "1"); err == nil {
+			t.Fatalf("expected error for %q", key)
+		}
+	}
+
+	want := []string{"A=1", "_x=1", "PATH_2=1", "lower=1"}
+	if got := envArgs(sbox); !reflect.DeepEqual(got, want) {
+		t.Fatalf("env:\n got: %q\nwant: %q", got, want)
+	}
+
+	if err := sbox.AddEnvFile(writeFile(t, ".env", "2FA=1\n")); err == nil {
+		t.Fatal("expected error for invalid name in dotenv file")
+	}
+}
@@ -0,0 +1,146 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envSettings lists the settings read by NewFromEnv, by variable name without the prefix.
+var envSettings = []struct {
+	name  string
+	apply func(s *Sandbox, value string) error
+}{
+	{"MEM_LIMIT", func(s *Sandbox, v string) error {
+		n, err := parseSize(v)
+		if err == nil {
+			s.SetMemLimit(n)
+		}
+		return err
+	}},
+	{"MEM_HIGH", func(s *Sandbox, v string) error {
+		n, err := parseSize(v)
+		if err == nil {
+			s.SetMemHigh(n)
+		}
+		return err
+	}},
+	{"PIDS_MAX", func(s *Sandbox, v string) error {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err == nil {
+			s.SetPidLimit(n)
+		}
+		return err
+	}},
+	{"RLIMITS", func(s *Sandbox, v string) error {
+		return s.SetRlimits(v)
+	}},
+	{"NICE", func(s *Sandbox, v string) error {
+		n, err := strconv.Atoi(v)
+		if err == nil {
+			s.SetNice(n)
+		}
+		return err
+	}},
+	{"CGROUP", func(s *Sandbox, v string) error {
+		s.SetCGroup(v)
+		return nil
+	}},
+	{"CPUSET", func(s *Sandbox, v string) error {
+		s.SetCpuSet(v)
+		return nil
+	}},
+	{"NO_NEW_NET", func(s *Sandbox, v string) error {
+		b, err := parseEnvBool(v)
+		if err == nil {
+			s.SetNoNewNet(b)
+		}
+		return err
+	}},
+	{"SETUP_TIME_LIMIT", func(s *Sandbox, v string) error {
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			s.SetSetupTimeLimit(d)
+		}
+		return err
+	}},
+	{"WALL_TIME_LIMIT", func(s *Sandbox, v string) error {
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			s.SetWallTimeLimit(d)
+		}
+		return err
+	}},
+	{"EXEC_DIR", func(s *Sandbox, v string) error {
+		s.ExecDir(v)
+		return nil
+	}},
+	{"TMP_DIR", func(s *Sandbox, v string) error {
+		s.SetTmpDir(v)
+		return nil
+	}},
+	{"READ_ONLY_ROOT", func(s *Sandbox, v string) error {
+		b, err := parseEnvBool(v)
+		if err == nil && b {
+			s.SetReadOnlyRootWithWritable()
+		}
+		return err
+	}},
+}
+
+// NewFromEnv creates a sandbox configuration from host environment variables, each named after a
+// setting and prefixed with prefix and an underscore, e.g. SANDBOX_MEM_LIMIT for the prefix
+// "SANDBOX". The sandbox root is read from PREFIX_ROOT, which must be set. The other variables are
+// optional, and unset or empty ones keep the defaults of New:
+//
+//	MEM_LIMIT, MEM_HIGH      sizes, with an optional K, M, G or T suffix
+//	PIDS_MAX, NICE           integers
+//	RLIMITS                  a spec for SetRlimits, such as "nofile=64,as=256M"
+//	CGROUP, CPUSET           strings
+//	NO_NEW_NET               a boolean: 1, true, yes or on, or 0, false, no or off
+//	READ_ONLY_ROOT           a boolean, as SetReadOnlyRootWithWritable with no writable paths
+//	SETUP_TIME_LIMIT         a duration, such as "2s"
+//	WALL_TIME_LIMIT          a duration
+//	EXEC_DIR, TMP_DIR        paths
+//
+// Other variables with the prefix are ignored. The error names the offending variable.
+func NewFromEnv(prefix string) (*Sandbox, error) {
+	if prefix != "" {
+		prefix += "_"
+	}
+
+	root := os.Getenv(prefix + "ROOT")
+	if root == "" {
+		return nil, fmt.Errorf("sandbox: %sROOT is not set", prefix)
+	}
+
+	s := New(root)
+	for _, setting := range envSettings {
+		name := prefix + setting.name
+
+		value := strings.TrimSpace(os.Getenv(name))
+		if value == "" {
+			continue
+		}
+
+		if err := setting.apply(s, value); err != nil {
+			return nil, fmt.Errorf("sandbox: %s: %w", name, err)
+		}
+	}
+
+	return s, nil
+}
+
+// parseEnvBool parses a boolean leniently, ignoring case.
+func parseEnvBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "1", "t", "true", "y", "yes", "on":
+		return true, nil
+	case "0", "f", "false", "n", "no", "off":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("invalid boolean %q", value)
+}
@@ -0,0 +1,48 @@
+package sandbox_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestNewFromEnv(t *testing.T) {
+	t.Setenv("SANDBOX_ROOT", "/root")
+	t.Setenv("SANDBOX_MEM_LIMIT", "256M")
+	t.Setenv("SANDBOX_NO_NEW_NET", "Yes")
+	t.Setenv("SANDBOX_CGROUP", "cg")
+	t.Setenv("SANDBOX_CPUSET", "0-1")
+	t.Setenv("SANDBOX_RLIMITS", "nofile=64")
+	t.Setenv("SANDBOX_WALL_TIME_LIMIT", "3s")
+	t.Setenv("SANDBOX_EXEC_DIR", "")
+	t.Setenv("SANDBOX_UNKNOWN", "x")
+
+	sbox, err := sandbox.NewFromEnv("SANDBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := sandbox.New("/root").
+		SetMemLimit(256<<20).
+		SetNoNewNet(true).
+		SetCGroup("cg").
+		SetCpuSet("0-1").
+		SetRlimit("nofile", 64).
+		SetWallTimeLimit(3 * time.Second)
+	if got, want := sbox.BuildExecArgs("/bin/true", nil), want.BuildExecArgs("/bin/true", nil); !reflect.DeepEqual(got, want) {
+		t.Fatalf("args:\n got: %q\nwant: %q", got, want)
+	}
+
+	t.Setenv("SANDBOX_NO_NEW_NET", "maybe")
+	if _, err := sandbox.NewFromEnv("SANDBOX"); err == nil || !strings.Contains(err.Error(), "SANDBOX_NO_NEW_NET") {
+		t.Fatalf("expected error naming SANDBOX_NO_NEW_NET, got %v", err)
+	}
+
+	t.Setenv("SANDBOX_ROOT", "")
+	if _, err := sandbox.NewFromEnv("SANDBOX"); err == nil {
+		t.Fatal("expected error for missing root")
+	}
+}
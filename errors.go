@@ -0,0 +1,64 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	// ErrEmptyRoot means that the sandbox root path passed to New is empty.
+	ErrEmptyRoot = errors.New("empty sandbox root")
+	// ErrDuplicateDst means that two file or directory mappings share a destination.
+	ErrDuplicateDst = errors.New("duplicate destination")
+	// ErrMissingSource means that the host source of a mapping does not exist.
+	ErrMissingSource = errors.New("missing source")
+	// ErrOutOfRange means that a numeric setting is outside of its accepted range.
+	ErrOutOfRange = errors.New("value out of range")
+	// ErrMountLoop means that a directory is mounted below itself, which makes the mount recursive.
+	ErrMountLoop = errors.New("mount loop")
+	// ErrNested means that the configuration would run the sandbox tool inside the sandbox.
+	ErrNested = errors.New("nested sandbox")
+	// ErrUnsupportedFlag means that the installed sandbox tool does not support a flag that the
+	// configuration needs, see SetStrictFlags.
+	ErrUnsupportedFlag = errors.New("unsupported flag")
+	// ErrPolicy means that the configuration violates a policy set on the builder, such as
+	// allowed source or destination prefixes.
+	ErrPolicy = errors.New("policy violation")
+)
+
+// ConfigError describes an invalid setting found by Validate.
+//
+// Err, when set, is one of the sentinel errors of this package and can be matched with errors.Is.
+type ConfigError struct {
+	// Field is the name of the setting, as used by ConfigString, e.g. "file" or "mem_limit".
+	Field string
+	// Index is the position of the entry within a repeated setting, or -1.
+	Index int
+	// Reason is a human-readable description of the problem.
+	Reason string
+	// Err is the underlying cause, or nil.
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	field := e.Field
+	if e.Index >= 0 {
+		field += "[" + strconv.Itoa(e.Index) + "]"
+	}
+
+	return "sandbox: " + field + ": " + e.Reason
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+func configErr(field string, index int, cause error, format string, args ...interface{}) *ConfigError {
+	return &ConfigError{
+		Field:  field,
+		Index:  index,
+		Reason: fmt.Sprintf(format, args...),
+		Err:    cause,
+	}
+}
@@ -0,0 +1,36 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// execFD is the descriptor number under which the program file is passed to the sandbox tool:
+// the first entry of exec.Cmd.ExtraFiles is always descriptor 3 in the child.
+const execFD = 3
+
+// CommandFD constructs an exec.Cmd that runs the program in the open file prog, such as a memfd,
+// inside the configured sandbox, so that the program never needs a path in the sandbox filesystem.
+//
+// The file is passed to the tool through ExtraFiles and executed with the --exec_fd flag. The
+// program sees "/dev/fd/3" as argv[0], followed by args. The caller keeps ownership of prog and
+// must keep it open until the command has started. ctx may be nil, as with Command.
+//
+// The program is executed by the tool directly, so a setup command set with SetSetupCommand is
+// not run, with a warning.
+func (s *Sandbox) CommandFD(ctx context.Context, prog *os.File, args ...string) *exec.Cmd {
+	if s.setupCmd != nil {
+		warnf("setup command is ignored when running a program from a file descriptor")
+	}
+
+	execArgs := s.flagArgs(false)
+	execArgs = append(execArgs, "--exec_fd", strconv.Itoa(execFD), s.separatorToken(), "/dev/fd/"+strconv.Itoa(execFD))
+	execArgs = append(execArgs, args...)
+
+	cmd := s.newCmd(ctx, execArgs)
+	cmd.ExtraFiles = []*os.File{prog}
+
+	return cmd
+}
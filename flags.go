@@ -0,0 +1,149 @@
+package sandbox
+
+import "sort"
+
+// flagMapping maps builder settings, named after their setters without the Set prefix, to the
+// sandbox tool flags they emit.
+var flagMapping = map[string]string{
+	"AddFile":              "--add_file",
+	"AddFileWithLibs":      "--add_elf_file",
+	"ElfLibDepth":          "--elf_lib_depth",
+	"LibCache":             "--lib_cache",
+	"LibSearchPaths":       "--lib_search_path",
+	"MountDir":             "--mount_dir",
+	"MountDirReadOnly":     "--mount_dir_ro",
+	"MountDirQuota":        "--mount_dir_quota",
+	"MountDirIDMapUID":     "--uid_map",
+	"MountDirIDMapGID":     "--gid_map",
+	"MountPropagation":     "--mount_propagation",
+	"Env":                  "--env",
+	"NoNewNet":             "--no_new_net",
+	"NetNamespace":         "--net_ns",
+	"Namespaces":           "--unshare",
+	"NetBandwidth":         "--net_bandwidth",
+	"CGroup":               "--cgroup",
+	"CpuSet":               "--cpuset",
+	"Nice":                 "--nice",
+	"MemLimit":             "--mem_limit",
+	"MemHigh":              "--mem_high",
+	"PidLimit":             "--pids_max",
+	"Rlimit":               "--rlimit",
+	"CpuMax":               "--cpu_max",
+	"OOMScoreAdj":          "--oom_score_adj",
+	"CapabilitySet":        "--cap_bounding_set",
+	"UIDsReal":             "--ruid",
+	"UIDsEffective":        "--euid",
+	"UIDsSaved":            "--suid",
+	"CoreDumpPath":         "--core_dump_path",
+	"SyscallTrace":         "--syscall_trace",
+	"LockMemory":           "--lock_memory",
+	"LimitExitCode":        "--limit_exit_code",
+	"SchedPolicy":          "--sched_policy",
+	"SchedPriority":        "--sched_priority",
+	"SaveUsageStat":        "--save_usage_stat",
+	"UsageStatInterval":    "--usage_stat_interval",
+	"SetupTimeLimit":       "--setup_time_limit",
+	"WallTimeLimit":        "--wall_time_limit",
+	"TimeLimitSignal":      "--time_limit_signal",
+	"TimeOffset":           "--time_offset",
+	"ExecDir":              "--exec_dir",
+	"TmpDir":               "--tmp_dir",
+	"ChrootDir":            "--chroot_dir",
+	"ReadOnlyRoot":         "--read_only_root",
+	"Writable":             "--writable",
+	"KillChildrenOnExit":   "--kill_children_on_exit",
+	"NoKillChildrenOnExit": "--no_kill_children_on_exit",
+	"Verbosity":            "--verbosity",
+	"Sysctl":               "--sysctl",
+	"Label":                "--label",
+	"ConfigFileMode":       "--config",
+	"Argv0":                "--argv0",
+	"ExecFD":               "--exec_fd",
+}
+
+// flagArity is the number of arguments each flag of flagMapping takes.
+var flagArity = map[string]int{
+	"--add_file": 2, "--add_elf_file": 2, "--elf_lib_depth": 1, "--lib_cache": 1, "--lib_search_path": 1,
+	"--mount_dir": 2, "--mount_dir_ro": 2, "--mount_dir_quota": 3, "--uid_map": 2, "--gid_map": 2,
+	"--mount_propagation": 1, "--env": 1, "--no_new_net": 0, "--net_ns": 1, "--unshare": 1,
+	"--net_bandwidth": 1, "--cgroup": 1, "--cpuset": 1, "--nice": 1, "--mem_limit": 1, "--mem_high": 1,
+	"--pids_max": 1, "--rlimit": 1, "--cpu_max": 2, "--oom_score_adj": 1, "--cap_bounding_set": 1,
+	"--ruid": 1, "--euid": 1, "--suid": 1, "--core_dump_path": 1, "--syscall_trace": 1, "--lock_memory": 0,
+	"--limit_exit_code": 1, "--sched_policy": 1, "--sched_priority": 1, "--save_usage_stat": 1,
+	"--usage_stat_interval": 1, "--setup_time_limit": 1, "--wall_time_limit": 1, "--time_limit_signal": 1,
+	"--time_offset": 1, "--exec_dir": 1, "--tmp_dir": 1, "--chroot_dir": 1, "--read_only_root": 0,
+	"--writable": 1, "--kill_children_on_exit": 0, "--no_kill_children_on_exit": 0, "--verbosity": 1,
+	"--sysctl": 1, "--label": 1, "--config": 1, "--argv0": 1, "--exec_fd": 1,
+}
+
+// splitFlags groups flags, as emitted by buildFlags, with their arguments, each group starting with
+// the flag name. Groups are formed by the arity of each flag, so arguments that look like flags,
+// such as an environment value of --foo, stay with their flag.
+func splitFlags(flags []string) [][]string {
+	var groups [][]string
+	for len(flags) != 0 {
+		n, ok := flagArity[flags[0]]
+		if !ok {
+			n = 1
+		}
+		if n >= len(flags) {
+			n = len(flags) - 1
+		}
+
+		groups = append(groups, flags[:n+1:n+1])
+		flags = flags[n+1:]
+	}
+
+	return groups
+}
+
+// FlagMapping returns the sandbox tool flag emitted for each builder setting, keyed by the setter
+// name without the Set prefix, e.g. "MemLimit" maps to "--mem_limit". Settings that emit one of
+// several flags have an entry per flag, such as "AddFile" and "AddFileWithLibs". The returned
+// map is a copy and may be modified.
+func FlagMapping() map[string]string {
+	m := make(map[string]string, len(flagMapping))
+	for k, v := range flagMapping {
+		m[k] = v
+	}
+
+	return m
+}
+
+// commandFlags are the flags that depend on how the command is started rather than on the
+// configuration; UnsetFlags never reports them.
+var commandFlags = map[string]bool{"--config": true, "--argv0": true, "--exec_fd": true}
+
+// alternativeFlags are pairs of mutually exclusive flags; UnsetFlags reports neither of a pair once
+// one of them is emitted.
+var alternativeFlags = [][2]string{
+	{"--kill_children_on_exit", "--no_kill_children_on_exit"},
+	{"--no_new_net", "--net_ns"},
+}
+
+// UnsetFlags returns, sorted, the sandbox tool flags of FlagMapping that the current configuration
+// does not emit because their settings are unset, e.g. "--mem_limit" if SetMemLimit was never
+// called or was given 0. It is a debugging aid to be read together with Describe. Flags that only
+// depend on how the command is started, such as --argv0, are not reported, and neither of two
+// mutually exclusive flags, such as --no_new_net and --net_ns, is reported once one is emitted.
+func (s *Sandbox) UnsetFlags() []string {
+	emitted := make(map[string]bool)
+	for _, group := range splitFlags(s.buildFlags(true)[1:]) {
+		emitted[group[0]] = true
+	}
+	for _, alt := range alternativeFlags {
+		if emitted[alt[0]] || emitted[alt[1]] {
+			emitted[alt[0]], emitted[alt[1]] = true, true
+		}
+	}
+
+	var unset []string
+	for _, flag := range flagMapping {
+		if !emitted[flag] && !commandFlags[flag] {
+			unset = append(unset, flag)
+		}
+	}
+	sort.Strings(unset)
+
+	return unset
+}
@@ -0,0 +1,51 @@
+package sandbox
+
+import "time"
+
+// Limits groups the common resource limits, for configurations that are deserialized as a whole.
+// Zero fields are left unset.
+type Limits struct {
+	// Memory is the memory limit in bytes, see SetMemLimit.
+	Memory uint64
+	// CpuTime is the CPU time limit. It is applied as the "cpu" resource limit, in whole seconds
+	// rounded up.
+	CpuTime time.Duration
+	// WallTime is the real time limit, see SetWallTimeLimit.
+	WallTime time.Duration
+	// Pids is the number of processes and threads of the sandbox, see SetPidLimit.
+	Pids uint64
+	// OpenFiles is the "nofile" resource limit.
+	OpenFiles uint64
+	// OutputSize is the "fsize" resource limit, the largest file the process may write, in bytes.
+	OutputSize uint64
+}
+
+// SetLimits applies every non-zero field of l through the corresponding individual setter, so
+// SetLimits can be combined with them: later calls override earlier values.
+func (s *Sandbox) SetLimits(l Limits) *Sandbox {
+	if l.Memory != 0 {
+		s.SetMemLimit(l.Memory)
+	}
+
+	if l.CpuTime > 0 {
+		s.SetRlimit("cpu", uint64((l.CpuTime+time.Second-1)/time.Second))
+	}
+
+	if l.WallTime != 0 {
+		s.SetWallTimeLimit(l.WallTime)
+	}
+
+	if l.Pids != 0 {
+		s.SetPidLimit(l.Pids)
+	}
+
+	if l.OpenFiles != 0 {
+		s.SetRlimit("nofile", l.OpenFiles)
+	}
+
+	if l.OutputSize != 0 {
+		s.SetRlimit("fsize", l.OutputSize)
+	}
+
+	return s
+}
@@ -0,0 +1,13 @@
+package sandbox
+
+import "log"
+
+// Warnf reports configuration problems that do not prevent the sandbox from running, such as
+// settings that are ignored. It defaults to log.Printf; set it to nil to silence warnings.
+var Warnf = log.Printf
+
+func warnf(format string, args ...interface{}) {
+	if Warnf != nil {
+		Warnf("sandbox: "+format, args...)
+	}
+}
@@ -0,0 +1,97 @@
+package sandbox
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Namespaces is a set of Linux namespaces that the sandboxed process is placed into.
+type Namespaces uint
+
+const (
+	NamespacePID Namespaces = 1 << iota
+	NamespaceIPC
+	NamespaceUTS
+	NamespaceMount
+	NamespaceUser
+	NamespaceNet
+)
+
+var namespaceNames = []struct {
+	ns   Namespaces
+	name string
+}{
+	{NamespacePID, "pid"},
+	{NamespaceIPC, "ipc"},
+	{NamespaceUTS, "uts"},
+	{NamespaceMount, "mount"},
+	{NamespaceUser, "user"},
+	{NamespaceNet, "net"},
+}
+
+// String returns the comma-separated names of the namespaces in the set, e.g. "pid,ipc".
+func (n Namespaces) String() string {
+	var names []string
+	for _, nn := range namespaceNames {
+		if n&nn.ns != 0 {
+			names = append(names, nn.name)
+		}
+	}
+
+	return strings.Join(names, ",")
+}
+
+func parseNamespaces(s string) (Namespaces, error) {
+	var n Namespaces
+
+	for _, name := range strings.Split(s, ",") {
+		found := false
+		for _, nn := range namespaceNames {
+			if nn.name == name {
+				n |= nn.ns
+				found = true
+			}
+		}
+
+		if !found {
+			return 0, fmt.Errorf("sandbox: unknown namespace %q", name)
+		}
+	}
+
+	return n, nil
+}
+
+// SetNamespaces selects which namespaces are unshared for the sandboxed process.
+//
+// NamespaceNet is equivalent to SetNoNewNet(true); leaving it out does not undo an earlier
+// SetNoNewNet(true). The other namespaces are passed to the tool with the --unshare flag. When none
+// of them is selected, the tool defaults apply.
+func (s *Sandbox) SetNamespaces(ns Namespaces) *Sandbox {
+	s.namespaces = ns &^ NamespaceNet
+	if ns&NamespaceNet != 0 {
+		s.noNewNet = true
+	}
+
+	return s
+}
+
+// SetNetNamespace makes the sandboxed process join the existing network namespace at the host
+// path, such as /run/netns/judge or /proc/PID/ns/net, so that it shares a pre-configured network
+// with e.g. a test server, instead of the tool's default network. An empty path restores the
+// default.
+//
+// Joining a namespace and creating a new isolated one are mutually exclusive: Validate fails if
+// SetNoNewNet(true), or NamespaceNet, is also set.
+func (s *Sandbox) SetNetNamespace(path string) *Sandbox {
+	s.netNS = path
+
+	return s
+}
+
+func (s *Sandbox) validateNetNamespace() error {
+	if s.netNS != "" && s.noNewNet {
+		return configErr("net_ns", -1, nil, "joining network namespace %s conflicts with no_new_net", s.netNS)
+	}
+
+	return nil
+}
@@ -0,0 +1,341 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ParseArgs reconstructs a sandbox configuration from a sandbox tool argument list, as produced by
+// BuildExecArgs, and returns it together with the command path and arguments.
+//
+// argv must not include the sandbox executable itself and must use the default "--" separator.
+// Unknown flags are reported as an error.
+// Secret environment variables cannot be told apart in argv and are restored as regular ones.
+func ParseArgs(argv []string) (*Sandbox, string, []string, error) {
+	if len(argv) == 0 {
+		return nil, "", nil, errors.New("sandbox: empty argument list")
+	}
+
+	s := New(argv[0])
+	rest := argv[1:]
+
+	for len(rest) > 0 {
+		flag := rest[0]
+		rest = rest[1:]
+
+		if flag == "--" {
+			if len(rest) == 0 {
+				return nil, "", nil, errors.New("sandbox: missing command after --")
+			}
+
+			return s, rest[0], rest[1:], nil
+		}
+
+		values := func(n int) ([]string, error) {
+			if len(rest) < n {
+				return nil, fmt.Errorf("sandbox: flag %s expects %d value(s)", flag, n)
+			}
+
+			v := rest[:n]
+			rest = rest[n:]
+			return v, nil
+		}
+
+		var err error
+		var v []string
+
+		switch flag {
+		case "--add_file", "--add_elf_file":
+			if v, err = values(2); err == nil {
+				// A file after a directory mount can only come from SetPreserveInsertionOrder.
+				if len(s.mountDirs) != 0 {
+					s.SetPreserveInsertionOrder(true)
+				}
+				s.AddFile(v[0], v[1], flag == "--add_elf_file")
+			}
+		case "--mount_dir":
+			if v, err = values(2); err == nil {
+				s.MountDir(v[0], v[1])
+			}
+		case "--mount_dir_ro":
+			if v, err = values(2); err == nil {
+				s.MountDirReadOnly(v[0], v[1])
+			}
+		case "--uid_map", "--gid_map":
+			if v, err = values(2); err == nil {
+				err = fmt.Errorf("sandbox: %s for %s does not follow its mount", flag, v[0])
+				for i := len(s.mountDirs) - 1; i >= 0; i-- {
+					if s.mountDirs[i].dst != v[0] {
+						continue
+					}
+
+					if _, err = parseIDMap(v[1]); err == nil {
+						if flag == "--uid_map" {
+							s.mountDirs[i].uidMap = v[1]
+						} else {
+							s.mountDirs[i].gidMap = v[1]
+						}
+					}
+					break
+				}
+			}
+		case "--config":
+			if v, err = values(1); err == nil {
+				s.SetConfigFileMode(v[0])
+			}
+		case "--mount_dir_quota":
+			if v, err = values(3); err == nil {
+				var quota uint64
+				if quota, err = parseUint(flag, v[2]); err == nil {
+					s.MountDirQuota(v[0], v[1], quota)
+				}
+			}
+		case "--elf_lib_depth":
+			if v, err = values(1); err == nil {
+				if s.elfLibDepth, err = strconv.Atoi(v[0]); err != nil {
+					err = fmt.Errorf("sandbox: invalid value %q for %s", v[0], flag)
+				}
+			}
+		case "--lib_cache":
+			if v, err = values(1); err == nil {
+				s.SetLibCache(v[0])
+			}
+		case "--lib_search_path":
+			if v, err = values(1); err == nil {
+				s.libPaths = append(s.libPaths, v[0])
+			}
+		case "--mount_propagation":
+			if v, err = values(1); err == nil {
+				s.SetMountPropagation(PropagationMode(v[0]))
+			}
+		case "--env":
+			if v, err = values(1); err == nil {
+				s.AddEnv(v[0])
+			}
+		case "--no_new_net":
+			s.SetNoNewNet(true)
+		case "--net_ns":
+			if v, err = values(1); err == nil {
+				s.SetNetNamespace(v[0])
+			}
+		case "--unshare":
+			if v, err = values(1); err == nil {
+				var ns Namespaces
+				if ns, err = parseNamespaces(v[0]); err == nil {
+					s.namespaces = ns &^ NamespaceNet
+				}
+			}
+		case "--net_bandwidth":
+			if v, err = values(1); err == nil {
+				s.netBandwidth, err = parseUint(flag, v[0])
+			}
+		case "--cgroup":
+			if v, err = values(1); err == nil {
+				s.SetCGroup(v[0])
+			}
+		case "--cpuset":
+			if v, err = values(1); err == nil {
+				s.SetCpuSet(v[0])
+			}
+		case "--nice":
+			if v, err = values(1); err == nil {
+				var n int
+				if n, err = strconv.Atoi(v[0]); err != nil {
+					err = fmt.Errorf("sandbox: invalid value %q for %s", v[0], flag)
+				}
+				s.SetNice(n)
+			}
+		case "--mem_limit":
+			if v, err = values(1); err == nil {
+				s.memLimit, err = parseUint(flag, v[0])
+			}
+		case "--mem_high":
+			if v, err = values(1); err == nil {
+				s.memHigh, err = parseUint(flag, v[0])
+			}
+		case "--pids_max":
+			if v, err = values(1); err == nil {
+				s.pidsMax, err = parseUint(flag, v[0])
+			}
+		case "--rlimit":
+			if v, err = values(1); err == nil {
+				kv := strings.SplitN(v[0], "=", 2)
+				if len(kv) != 2 {
+					err = fmt.Errorf("sandbox: invalid value %q for %s", v[0], flag)
+				} else {
+					var limit uint64
+					if limit, err = parseUint(flag, kv[1]); err == nil {
+						s.SetRlimit(kv[0], limit)
+					}
+				}
+			}
+		case "--cpu_max":
+			if v, err = values(2); err == nil {
+				if s.cpuMaxQuota, err = parseUint(flag, v[0]); err == nil {
+					s.cpuMaxPeriod, err = parseUint(flag, v[1])
+				}
+			}
+		case "--cap_bounding_set":
+			if v, err = values(1); err == nil {
+				s.SetCapabilitySet()
+				if v[0] != "" {
+					s.SetCapabilitySet(strings.Split(v[0], ",")...)
+				}
+			}
+		case "--ruid", "--euid", "--suid":
+			if v, err = values(1); err == nil {
+				var id int
+				if id, err = strconv.Atoi(v[0]); err != nil {
+					err = fmt.Errorf("sandbox: invalid value %q for %s", v[0], flag)
+				} else {
+					if s.uids == nil {
+						s.SetUIDs(-1, -1, -1)
+					}
+					s.uids[strings.Index("res", flag[2:3])] = id
+				}
+			}
+		case "--oom_score_adj":
+			if v, err = values(1); err == nil {
+				var adj int
+				if adj, err = strconv.Atoi(v[0]); err != nil {
+					err = fmt.Errorf("sandbox: invalid value %q for %s", v[0], flag)
+				}
+				s.SetOOMScoreAdj(adj)
+			}
+		case "--core_dump_path":
+			if v, err = values(1); err == nil {
+				s.coreDumpPath = v[0]
+			}
+		case "--syscall_trace":
+			if v, err = values(1); err == nil {
+				s.SetSyscallTrace(v[0])
+			}
+		case "--lock_memory":
+			s.lockMemory = true
+		case "--time_limit_signal":
+			if v, err = values(1); err == nil {
+				var sig int
+				if sig, err = strconv.Atoi(v[0]); err == nil {
+					s.SetTimeLimitSignal(syscall.Signal(sig))
+				} else {
+					err = fmt.Errorf("sandbox: invalid value %q for %s", v[0], flag)
+				}
+			}
+		case "--limit_exit_code":
+			if v, err = values(1); err == nil {
+				if s.limitExit, err = strconv.Atoi(v[0]); err != nil {
+					err = fmt.Errorf("sandbox: invalid value %q for %s", v[0], flag)
+				}
+			}
+		case "--sched_policy":
+			if v, err = values(1); err == nil {
+				s.schedPolicy = SchedPolicy(v[0])
+				s.allowRealtime = true
+			}
+		case "--sched_priority":
+			if v, err = values(1); err == nil {
+				if s.schedPriority, err = strconv.Atoi(v[0]); err != nil {
+					err = fmt.Errorf("sandbox: invalid value %q for %s", v[0], flag)
+				}
+			}
+		case "--save_usage_stat":
+			if v, err = values(1); err == nil {
+				s.SaveUsageStat(v[0])
+			}
+		case "--usage_stat_interval":
+			if v, err = values(1); err == nil {
+				var ms uint64
+				if ms, err = parseUint(flag, v[0]); err == nil {
+					s.SetUsageStatInterval(time.Duration(ms) * time.Millisecond)
+				}
+			}
+		case "--setup_time_limit":
+			if v, err = values(1); err == nil {
+				var ms uint64
+				if ms, err = parseUint(flag, v[0]); err == nil {
+					s.SetSetupTimeLimit(time.Duration(ms) * time.Millisecond)
+				}
+			}
+		case "--wall_time_limit":
+			if v, err = values(1); err == nil {
+				var ms uint64
+				if ms, err = parseUint(flag, v[0]); err == nil {
+					s.SetWallTimeLimit(time.Duration(ms) * time.Millisecond)
+				}
+			}
+		case "--time_offset":
+			if v, err = values(1); err == nil {
+				var ms int64
+				if ms, err = strconv.ParseInt(v[0], 10, 64); err != nil {
+					err = fmt.Errorf("sandbox: invalid value %q for %s", v[0], flag)
+				}
+				s.SetTimeOffset(time.Duration(ms) * time.Millisecond)
+			}
+		case "--exec_dir":
+			if v, err = values(1); err == nil {
+				s.ExecDir(v[0])
+			}
+		case "--tmp_dir":
+			if v, err = values(1); err == nil {
+				s.SetTmpDir(v[0])
+			}
+		case "--chroot_dir":
+			if v, err = values(1); err == nil {
+				s.SetChrootDir(v[0])
+			}
+		case "--read_only_root":
+			s.readOnlyRoot = true
+		case "--writable":
+			if v, err = values(1); err == nil {
+				s.writable = append(s.writable, v[0])
+			}
+		case "--sysctl":
+			if v, err = values(1); err == nil {
+				kv := strings.SplitN(v[0], "=", 2)
+				if len(kv) != 2 {
+					err = fmt.Errorf("sandbox: invalid value %q for %s", v[0], flag)
+				} else {
+					s.SetSysctl(kv[0], kv[1])
+				}
+			}
+		case "--label":
+			if v, err = values(1); err == nil {
+				kv := strings.SplitN(v[0], "=", 2)
+				if len(kv) != 2 {
+					err = fmt.Errorf("sandbox: invalid value %q for %s", v[0], flag)
+				} else {
+					s.SetLabel(kv[0], kv[1])
+				}
+			}
+		case "--kill_children_on_exit", "--no_kill_children_on_exit":
+			s.SetKillChildrenOnExit(flag == "--kill_children_on_exit")
+		case "--verbosity":
+			if v, err = values(1); err == nil {
+				if s.verbosity, err = strconv.Atoi(v[0]); err != nil {
+					err = fmt.Errorf("sandbox: invalid value %q for %s", v[0], flag)
+				}
+			}
+		default:
+			err = fmt.Errorf("sandbox: unknown flag %q", flag)
+		}
+
+		if err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	return nil, "", nil, errors.New("sandbox: missing -- separator")
+}
+
+func parseUint(flag, value string) (uint64, error) {
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("sandbox: invalid value %q for %s", value, flag)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,135 @@
+package sandbox_test
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+// fullSandbox returns a sandbox that sets every setting that ParseArgs understands.
+func fullSandbox() *sandbox.Sandbox {
+	return sandbox.New("/root").
+		AddFile("/usr/bin/echo", "/bin/echo", true).
+		AddFile("/etc/hosts", "/etc/hosts", false).
+		SetElfLibDepth(2).
+		SetLibCache("/var/cache/libs").
+		SetLibSearchPaths("/opt/rt/lib", "/opt/rt/lib64").
+		MountDir("/data", "/data").
+		MountDirReadOnly("/opt", "/opt").
+		MountDirQuota("/srv/out", "/out", 1<<30).
+		MountDirIDMap("/home/u", "/home/u", []sandbox.IDMapEntry{{ContainerID: 0, HostID: 1000, Size: 1}}, []sandbox.IDMapEntry{{ContainerID: 0, HostID: 100, Size: 1}}).
+		SetMountPropagation(sandbox.PropagationSlave).
+		AddEnv("A=1").
+		SetNamespaces(sandbox.NamespacePID|sandbox.NamespaceIPC|sandbox.NamespaceNet).
+		SetNetBandwidth(1024).
+		SetCGroup("cg").
+		SetCpuSet("1-2").
+		SetNice(5).
+		SetMemLimit(1<<20).
+		SetMemHigh(1<<19).
+		SetPidLimit(32).
+		SetRlimit("nofile", 64).
+		SetRlimit("stack", 8<<20).
+		SetCpuMax(50000, 100000).
+		SetOOMScoreAdj(0).
+		SetUIDs(1000, 0, 1000).
+		SetCapabilitySet("CAP_NET_BIND_SERVICE", "sys_ptrace").
+		SetCoreDumpPath("/var/crash").
+		SetSyscallTrace("/tmp/trace").
+		SetLockMemory(true).
+		SetLimitExitCode(100).
+		SetSchedPolicy(sandbox.SchedFIFO, 10).
+		SaveUsageStat("/tmp/usage").
+		SetUsageStatInterval(500*time.Millisecond).
+		SetSetupTimeLimit(2*time.Second).
+		SetWallTimeLimit(10*time.Second).
+		SetTimeLimitSignal(syscall.SIGTERM).
+		SetTimeOffset(-time.Hour).
+		ExecDir("/work").
+		SetTmpDir("/var/tmp/run").
+		SetChrootDir("rootfs").
+		SetReadOnlyRootWithWritable("/tmp", "/work").
+		SetKillChildrenOnExit(false).
+		SetVerbosity(-1).
+		SetSysctl("net.ipv4.ip_forward", "1").
+		SetLabel("submission", "42")
+}
+
+func TestParseArgsRoundTrip(t *testing.T) {
+	argv := fullSandbox().BuildExecArgs("/bin/echo", []string{"a", "--", "b"})
+
+	parsed, path, args, err := sandbox.ParseArgs(argv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := parsed.BuildExecArgs(path, args); !reflect.DeepEqual(got, argv) {
+		t.Fatalf("round trip mismatch:\n got: %q\nwant: %q", got, argv)
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	for _, argv := range [][]string{
+		nil,
+		{"/root", "--unknown", "--", "/bin/true"},
+		{"/root", "--mem_limit"},
+		{"/root", "--mem_limit", "x", "--", "/bin/true"},
+		{"/root", "--no_new_net"},
+		{"/root", "--"},
+	} {
+		if _, _, _, err := sandbox.ParseArgs(argv); err == nil {
+			t.Fatalf("expected error for %q", argv)
+		}
+	}
+}
+
+func TestFlagMapping(t *testing.T) {
+	mapped := make(map[string]bool)
+	for _, flag := range sandbox.FlagMapping() {
+		mapped[flag] = true
+	}
+
+	// Flags that fullSandbox cannot emit: alternatives and per-command flags.
+	emitted := map[string]bool{"--kill_children_on_exit": true, "--net_ns": true, "--config": true, "--argv0": true, "--exec_fd": true}
+	for _, arg := range fullSandbox().BuildExecArgs("/bin/true", nil)[1:] {
+		if arg == "--" {
+			break
+		}
+		if strings.HasPrefix(arg, "--") {
+			emitted[arg] = true
+			if !mapped[arg] {
+				t.Errorf("flag %s is missing from FlagMapping", arg)
+			}
+		}
+	}
+
+	for flag := range mapped {
+		if !emitted[flag] {
+			t.Errorf("FlagMapping lists %s, which is never emitted", flag)
+		}
+	}
+}
+
+func TestUnsetFlags(t *testing.T) {
+	if unset := fullSandbox().UnsetFlags(); len(unset) != 0 {
+		t.Fatalf("unexpected unset flags %q", unset)
+	}
+
+	unset := sandbox.New("/root").SetMemLimit(1 << 20).UnsetFlags()
+	if len(unset) == 0 || !sort.StringsAreSorted(unset) {
+		t.Fatalf("unexpected unset flags %q", unset)
+	}
+	for _, flag := range unset {
+		if flag == "--mem_limit" {
+			t.Fatalf("%s is set", flag)
+		}
+	}
+	if !reflect.DeepEqual(unset[:2], []string{"--add_elf_file", "--add_file"}) {
+		t.Fatalf("unexpected unset flags %q", unset)
+	}
+}
@@ -0,0 +1,127 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Invocation is a command to run inside a sandbox, used to describe the stages of a Pipeline.
+type Invocation struct {
+	Sandbox *Sandbox
+	Path    string
+	Args    []string
+}
+
+// Pipeline runs every stage in its own sandbox, concurrently, with the standard output of each
+// stage connected to the standard input of the next through an OS pipe, and waits for all of them.
+//
+// The returned slice has one Result per stage, holding its stderr and exit status; only the last
+// stage has captured stdout. Every stage is validated with ValidateCommand before anything is
+// started. Cancelling ctx kills all stages. If any stage fails, the error of the first failing
+// stage is returned, wrapped with its position, but the other stages are still waited for: a
+// stage reading from a failed one sees EOF, and one writing to it gets a broken pipe. Hooks, tee
+// writers and capture limits of the stage sandboxes are not used; their cleanups run at the end.
+func Pipeline(ctx context.Context, stages ...*Invocation) ([]*Result, error) {
+	if len(stages) == 0 {
+		return nil, nil
+	}
+
+	for i, st := range stages {
+		defer st.Sandbox.runCleanups()
+
+		if err := st.Sandbox.ValidateCommand(st.Path); err != nil {
+			return nil, fmt.Errorf("sandbox: pipeline stage %d: %w", i, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmds := make([]*exec.Cmd, len(stages))
+	stderrs := make([]bytes.Buffer, len(stages))
+	var stdout bytes.Buffer
+
+	// pipes[i] connects stage i to stage i+1. The parent closes both ends as soon as the stages
+	// using them have started, so that a stage only sees EOF or a broken pipe from its neighbours.
+	pipes := make([][2]*os.File, len(stages)-1)
+	defer func() {
+		for _, p := range pipes {
+			closeFiles(p[0], p[1])
+		}
+	}()
+
+	for i, st := range stages {
+		cmds[i] = st.Sandbox.CommandContext(ctx, st.Path, st.Args...)
+		cmds[i].Stderr = &stderrs[i]
+
+		if i > 0 {
+			r, w, err := os.Pipe()
+			if err != nil {
+				return nil, err
+			}
+			pipes[i-1] = [2]*os.File{r, w}
+			cmds[i-1].Stdout, cmds[i].Stdin = w, r
+		}
+	}
+	cmds[len(cmds)-1].Stdout = &stdout
+
+	errs := make([]error, len(stages))
+	started := 0
+	for ; started < len(cmds); started++ {
+		errs[started] = cmds[started].Start()
+
+		if started > 0 {
+			closeFiles(pipes[started-1][0])
+			pipes[started-1][0] = nil
+		}
+		if started < len(pipes) {
+			closeFiles(pipes[started][1])
+			pipes[started][1] = nil
+		}
+
+		if errs[started] != nil {
+			// Stages that have already started are killed and waited for below.
+			cancel()
+			break
+		}
+	}
+
+	for i := 0; i < started; i++ {
+		errs[i] = cmds[i].Wait()
+	}
+
+	results := make([]*Result, len(stages))
+
+	var firstErr error
+	for i, st := range stages {
+		res := &Result{
+			Stderr:   stderrs[i].Bytes(),
+			ExitCode: -1,
+			TimedOut: ctx.Err() == context.DeadlineExceeded,
+			MemLimit: st.Sandbox.memLimit,
+
+			CpuTimeLimit:  st.Sandbox.cpuTimeLimit(),
+			WallTimeLimit: st.Sandbox.wallLimit,
+		}
+		results[i] = res
+
+		if err := st.Sandbox.collect(res, cmds[i], errs[i]); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("sandbox: pipeline stage %d: %w", i, err)
+		}
+	}
+	results[len(results)-1].Stdout = stdout.Bytes()
+
+	return results, firstErr
+}
+
+// closeFiles closes the non-nil files.
+func closeFiles(files ...*os.File) {
+	for _, f := range files {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package sandbox_test
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestPipeline(t *testing.T) {
+	// The fake tool runs the command after the separator directly on the host.
+	script := writeFile(t, "tool.sh", `#!/bin/sh
+while [ "$1" != "--" ]; do shift; done
+shift
+exec "$@"
+`)
+	if err := os.Chmod(script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	withToolPath(t, script)
+
+	results, err := sandbox.Pipeline(context.Background(),
+		&sandbox.Invocation{Sandbox: sandbox.New("/root"), Path: "/bin/echo", Args: []string{"hello"}},
+		&sandbox.Invocation{Sandbox: sandbox.New("/root"), Path: "/bin/sh", Args: []string{"-c", "tr a-z A-Z; echo done >&2"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results", len(results))
+	}
+	if got := string(results[1].Stdout); got != "HELLO\n" {
+		t.Fatalf("unexpected stdout %q", got)
+	}
+	if got := string(results[1].Stderr); got != "done\n" {
+		t.Fatalf("unexpected stderr %q", got)
+	}
+	if results[0].ExitCode != 0 || results[1].ExitCode != 0 {
+		t.Fatalf("unexpected exit codes %d, %d", results[0].ExitCode, results[1].ExitCode)
+	}
+
+	results, err = sandbox.Pipeline(context.Background(),
+		&sandbox.Invocation{Sandbox: sandbox.New("/root"), Path: "/bin/sh", Args: []string{"-c", "exit 3"}},
+		&sandbox.Invocation{Sandbox: sandbox.New("/root"), Path: "/bin/cat"},
+	)
+	if err == nil {
+		t.Fatal("expected error for failing stage")
+	}
+	if results[0].ExitCode != 3 || results[1].ExitCode != 0 {
+		t.Fatalf("unexpected exit codes %d, %d", results[0].ExitCode, results[1].ExitCode)
+	}
+}
+
+func TestPipelineEarlyExit(t *testing.T) {
+	script := writeFile(t, "tool.sh", `#!/bin/sh
+while [ "$1" != "--" ]; do shift; done
+shift
+exec "$@"
+`)
+	if err := os.Chmod(script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	withToolPath(t, script)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	results, err := sandbox.Pipeline(ctx,
+		&sandbox.Invocation{Sandbox: sandbox.New("/root"), Path: "/usr/bin/yes"},
+		&sandbox.Invocation{Sandbox: sandbox.New("/root"), Path: "/usr/bin/head", Args: []string{"-n1"}},
+	)
+	if ctx.Err() != nil {
+		t.Fatal("pipeline did not finish after the last stage exited")
+	}
+	if err == nil || results[0].Signal != syscall.SIGPIPE {
+		t.Fatalf("expected the first stage to die of SIGPIPE, got %v, signal %v", err, results[0].Signal)
+	}
+	if got := string(results[1].Stdout); got != "y\n" {
+		t.Fatalf("unexpected stdout %q", got)
+	}
+}
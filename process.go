@@ -0,0 +1,195 @@
+package sandbox
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Process is a command running inside the sandbox, started with Start. Unlike Run, its standard
+// streams are connected to pipes, so the caller can talk to the program while it runs.
+type Process struct {
+	// Cmd is the underlying sandbox tool command.
+	Cmd *exec.Cmd
+
+	stdin   io.WriteCloser
+	stdout  io.ReadCloser
+	stderr  io.ReadCloser
+	pty     *os.File
+	bufSize int
+	outBuf  *bufio.Reader
+	errBuf  *bufio.Reader
+	done    chan struct{}
+	once    sync.Once
+}
+
+// SetAllocatePTY makes Start connect the standard streams of the sandbox tool to a new
+// pseudo-terminal, which becomes the controlling terminal of a new session, instead of pipes.
+// Whether the sandboxed program sees the terminal depends on the tool passing its standard streams
+// through. The terminal master is available from Process.PTY. Pseudo-terminals are only supported
+// on Linux.
+//
+// A new session is also a new process group, so SetNewProcessGroup and SetForeground are ignored.
+// Commands built by CommandContext are not affected; attach a terminal to them as needed.
+func (s *Sandbox) SetAllocatePTY(v bool) *Sandbox {
+	s.allocPTY = v
+
+	return s
+}
+
+// Start starts a command inside the sandbox and returns without waiting for it to finish.
+//
+// The configuration is checked with ValidateCommand first. The caller must read stdout and
+// stderr until EOF before calling Wait, as with exec.Cmd pipes.
+func (s *Sandbox) Start(ctx context.Context, path string, args ...string) (*Process, error) {
+	if err := s.ValidateCommand(path); err != nil {
+		return nil, err
+	}
+
+	p := &Process{Cmd: s.CommandContext(ctx, path, args...), done: make(chan struct{})}
+
+	if s.allocPTY {
+		if err := p.startPTY(); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	var err error
+	if p.stdin, err = p.Cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if p.stdout, err = p.Cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if p.stderr, err = p.Cmd.StderrPipe(); err != nil {
+		return nil, err
+	}
+
+	if err := p.Cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *Process) startPTY() error {
+	master, slave, err := openPTY()
+	if err != nil {
+		return err
+	}
+	defer slave.Close()
+
+	p.Cmd.Stdin, p.Cmd.Stdout, p.Cmd.Stderr = slave, slave, slave
+	p.Cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+
+	if err := p.Cmd.Start(); err != nil {
+		master.Close()
+		return err
+	}
+
+	p.pty = master
+	p.stdin, p.stdout, p.stderr = master, master, io.NopCloser(strings.NewReader(""))
+
+	return nil
+}
+
+// PTY returns the pseudo-terminal master if SetAllocatePTY was set, or nil. Stdin and Stdout read
+// and write the same terminal, and Stderr is always empty because standard error goes to the
+// terminal too. Once the program exits, reads fail with EIO rather than returning EOF. Wait
+// closes the master.
+func (p *Process) PTY() *os.File {
+	return p.pty
+}
+
+// SetReadBufferSize sets the size of the bufio.Reader that Stdout and Stderr wrap around the
+// underlying pipes. Zero or a negative value means the bufio default. It only affects readers
+// that have not been returned yet, so call it before the first Stdout or Stderr call.
+func (p *Process) SetReadBufferSize(n int) *Process {
+	p.bufSize = n
+
+	return p
+}
+
+// Stdin returns the pipe connected to the program standard input. Close it to signal EOF.
+func (p *Process) Stdin() io.WriteCloser {
+	return p.stdin
+}
+
+// Stdout returns a buffered reader wrapping the pipe connected to the program standard output.
+// Every call returns the same reader.
+func (p *Process) Stdout() *bufio.Reader {
+	if p.outBuf == nil {
+		p.outBuf = p.newReader(p.stdout)
+	}
+
+	return p.outBuf
+}
+
+// Stderr returns a buffered reader wrapping the pipe connected to the program standard error.
+// Every call returns the same reader.
+func (p *Process) Stderr() *bufio.Reader {
+	if p.errBuf == nil {
+		p.errBuf = p.newReader(p.stderr)
+	}
+
+	return p.errBuf
+}
+
+func (p *Process) newReader(r io.Reader) *bufio.Reader {
+	if p.bufSize <= 0 {
+		return bufio.NewReader(r)
+	}
+
+	return bufio.NewReaderSize(r, p.bufSize)
+}
+
+// Done returns a channel that is closed once the command has exited and the first Wait call has
+// returned, whether or not with an error. It lets other goroutines, such as a log tailer, stop when
+// the program finishes; a Process that is never waited for is never done.
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait waits for the command to exit and releases the pipes or the pseudo-terminal.
+func (p *Process) Wait() error {
+	err := p.Cmd.Wait()
+	if p.pty != nil {
+		p.pty.Close()
+	}
+	p.once.Do(func() { close(p.done) })
+
+	return err
+}
+
+// WaitReady calls probe every interval until it succeeds, for example until a sandboxed server
+// accepts connections. If ctx is done first, it returns the context error wrapped together with
+// the last probe error. A non-positive interval means 100ms.
+func (p *Process) WaitReady(ctx context.Context, probe func() error, interval time.Duration) error {
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := probe()
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("sandbox: process not ready: %w (last probe error: %v)", ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package sandbox_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestStartReadBufferSize(t *testing.T) {
+	withToolPath(t, "/bin/echo")
+
+	p, err := sandbox.New("/root").Start(context.Background(), "/bin/prog", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := p.SetReadBufferSize(64 << 10).Stdout()
+	if out.Size() != 64<<10 {
+		t.Fatalf("buffer size: %d", out.Size())
+	}
+
+	if p.Stdout() != out {
+		t.Fatal("Stdout returned a different reader")
+	}
+
+	line, err := out.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(line, "-- /bin/prog hello\n") {
+		t.Fatalf("stdout: %q", line)
+	}
+
+	if _, err := io.ReadAll(p.Stderr()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	withToolPath(t, "/bin/sleep")
+
+	p, err := sandbox.New("1").Start(context.Background(), "/bin/prog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Cmd.Process.Kill()
+
+	calls := 0
+	probe := func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	}
+
+	if err := p.WaitReady(context.Background(), probe, time.Millisecond); err != nil || calls != 3 {
+		t.Fatalf("WaitReady: %v after %d calls", err, calls)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err = p.WaitReady(ctx, func() error { return errors.New("never") }, time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+}
+
+func TestStartPTY(t *testing.T) {
+	if _, err := os.Stat("/dev/ptmx"); err != nil {
+		t.Skip("no pseudo-terminal support:", err)
+	}
+
+	script := writeFile(t, "tool.sh", "#!/bin/sh\ntty\n")
+	if err := os.Chmod(script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	withToolPath(t, script)
+
+	p, err := sandbox.New("/root").SetAllocatePTY(true).Start(context.Background(), "/bin/prog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.PTY() == nil {
+		t.Fatal("no pseudo-terminal master")
+	}
+
+	line, err := p.Stdout().ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(line, "/dev/pts/") {
+		t.Fatalf("tool is not attached to a terminal: %q", line)
+	}
+
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	withToolPath(t, filepath.Join(t.TempDir(), "missing"))
+	if p, err := sandbox.New("/root").SetAllocatePTY(true).Start(context.Background(), "/bin/prog"); err == nil || p != nil {
+		t.Fatalf("expected a nil process and an error, got %v, %v", p, err)
+	}
+}
+
+func TestProcessDone(t *testing.T) {
+	withToolPath(t, "/bin/false")
+
+	p, err := sandbox.New("/root").Start(context.Background(), "/bin/prog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-p.Done():
+		t.Fatal("done before Wait")
+	default:
+	}
+
+	go func() {
+		io.ReadAll(p.Stdout())
+		io.ReadAll(p.Stderr())
+		p.Wait()
+	}()
+
+	<-p.Done()
+	if err := p.Wait(); err == nil {
+		t.Fatal("expected error from second Wait")
+	}
+	<-p.Done()
+}
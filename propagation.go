@@ -0,0 +1,27 @@
+package sandbox
+
+// PropagationMode is the propagation type of the directories mounted with MountDir, see
+// mount_namespaces(7).
+type PropagationMode string
+
+const (
+	// PropagationPrivate isolates the mounts from the host in both directions. It is the default.
+	PropagationPrivate PropagationMode = "private"
+	// PropagationSlave makes mount events under the host directories, such as submounts added
+	// later, propagate into the sandbox, but not the other way around.
+	PropagationSlave PropagationMode = "slave"
+	// PropagationShared makes mount events propagate in both directions.
+	PropagationShared PropagationMode = "shared"
+)
+
+// SetMountPropagation sets the propagation type of the mounted directories. An empty mode means
+// the default, PropagationPrivate.
+//
+// WARNING: with PropagationShared, mounts made inside the sandbox, for example by a process running
+// as root in a user namespace, become visible on the host. Prefer PropagationSlave when the
+// sandbox only needs to see submounts added on the host.
+func (s *Sandbox) SetMountPropagation(mode PropagationMode) *Sandbox {
+	s.propagation = mode
+
+	return s
+}
@@ -0,0 +1,34 @@
+package sandbox
+
+// ResourceRequest summarizes the resources a configured sandbox asks for, for scheduling runs onto
+// hosts. Zero fields mean that the resource is not limited.
+type ResourceRequest struct {
+	// MemLimit is the memory limit in bytes, see SetMemLimit.
+	MemLimit uint64
+	// CPUs is the number of CPUs selected by SetCpuSet.
+	CPUs int
+	// PidsLimit is the limit set by SetPidLimit or, if there is none, the "nproc" resource limit.
+	PidsLimit uint64
+}
+
+// ResourceRequest returns the resources requested by the sandbox configuration. If the cpuset is
+// not a valid cpuset(7) list, CPUs is zero; Validate reports it.
+func (s *Sandbox) ResourceRequest() ResourceRequest {
+	req := ResourceRequest{MemLimit: s.memLimit}
+
+	if s.cpuSet != "" {
+		req.CPUs, _ = cpuSetSize(s.cpuSet)
+	}
+
+	for _, r := range s.rlimits {
+		if r.name == "nproc" {
+			req.PidsLimit = r.value
+		}
+	}
+
+	if s.pidsMax != 0 {
+		req.PidsLimit = s.pidsMax
+	}
+
+	return req
+}
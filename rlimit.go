@@ -0,0 +1,163 @@
+package sandbox
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type rlimit struct {
+	name  string
+	value uint64
+}
+
+// rlimitNames lists the resource names accepted by SetRlimit, as used by prlimit(1).
+var rlimitNames = map[string]bool{
+	"as": true, "core": true, "cpu": true, "data": true, "fsize": true, "locks": true,
+	"memlock": true, "msgqueue": true, "nice": true, "nofile": true, "nproc": true, "rss": true,
+	"rtprio": true, "rttime": true, "sigpending": true, "stack": true,
+}
+
+// SetRlimit sets both the soft and the hard limit of a process resource limit for the sandboxed
+// process. The resource is named as in prlimit(1), e.g. "nofile", "nproc" or "stack"; Validate
+// reports unknown names. Setting the same resource again replaces its value.
+//
+// Inotify instance and watch limits are per-user sysctls rather than resource limits, so they
+// cannot be configured per sandbox.
+func (s *Sandbox) SetRlimit(resource string, limit uint64) *Sandbox {
+	for i := range s.rlimits {
+		if s.rlimits[i].name == resource {
+			s.rlimits[i].value = limit
+			return s
+		}
+	}
+
+	s.rlimits = append(s.rlimits, rlimit{name: resource, value: limit})
+
+	return s
+}
+
+// SetMsgQueueLimit limits the total size, in bytes, of the POSIX message queues that the sandboxed
+// process may allocate, through the "msgqueue" resource limit. Zero removes the limit.
+//
+// The limit does not cover SysV IPC objects. Combine it with NamespaceIPC, see SetNamespaces, so
+// that the process gets its own IPC namespace, whose objects go away with the sandbox.
+func (s *Sandbox) SetMsgQueueLimit(bytes uint64) *Sandbox {
+	if bytes != 0 {
+		return s.SetRlimit("msgqueue", bytes)
+	}
+
+	for i, r := range s.rlimits {
+		if r.name == "msgqueue" {
+			s.rlimits = append(s.rlimits[:i:i], s.rlimits[i+1:]...)
+			break
+		}
+	}
+
+	return s
+}
+
+// SetRlimits sets several resource limits from a comma-separated spec of name=value pairs, such as
+// "as=256M,nproc=64,nofile=1024,cpu=10", each applied as with SetRlimit.
+//
+// Values may have a K, M, G or T suffix, for units of 1024 bytes and its powers, and may be
+// "unlimited". Nothing is set if any entry is malformed or names an unknown resource; the error
+// quotes the offending entry.
+func (s *Sandbox) SetRlimits(spec string) error {
+	var limits []rlimit
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("sandbox: invalid rlimit %q: missing '='", entry)
+		}
+
+		name := strings.TrimSpace(kv[0])
+		if !rlimitNames[name] {
+			return fmt.Errorf("sandbox: invalid rlimit %q: unknown resource %q", entry, name)
+		}
+
+		value, err := parseSize(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return fmt.Errorf("sandbox: invalid rlimit %q: %w", entry, err)
+		}
+
+		limits = append(limits, rlimit{name: name, value: value})
+	}
+
+	for _, r := range limits {
+		s.SetRlimit(r.name, r.value)
+	}
+
+	return nil
+}
+
+// parseSize parses a decimal number with an optional binary K, M, G or T suffix, or "unlimited".
+func parseSize(value string) (uint64, error) {
+	if value == "unlimited" {
+		return math.MaxUint64, nil
+	}
+
+	var shift uint
+	if n := len(value); n > 0 {
+		switch value[n-1] {
+		case 'k', 'K':
+			shift = 10
+		case 'm', 'M':
+			shift = 20
+		case 'g', 'G':
+			shift = 30
+		case 't', 'T':
+			shift = 40
+		}
+		if shift != 0 {
+			value = value[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	if n > math.MaxUint64>>shift {
+		return 0, fmt.Errorf("size %q overflows", value)
+	}
+
+	return n << shift, nil
+}
+
+// cpuTimeLimit returns the "cpu" resource limit, or zero if it is not set or unlimited.
+func (s *Sandbox) cpuTimeLimit() time.Duration {
+	var limit time.Duration
+	for _, r := range s.rlimits {
+		if r.name == "cpu" {
+			limit = 0
+			if r.value <= math.MaxInt64/uint64(time.Second) {
+				limit = time.Duration(r.value) * time.Second
+			}
+		}
+	}
+
+	return limit
+}
+
+func (r rlimit) String() string {
+	return r.name + "=" + strconv.FormatUint(r.value, 10)
+}
+
+func (s *Sandbox) validateRlimits() error {
+	for i, r := range s.rlimits {
+		if !rlimitNames[r.name] {
+			return configErr("rlimit", i, nil, "unknown resource %q", r.name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,291 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// ErrOutputTruncated is returned by Run when the command produced more output than allowed by
+// SetMaxCaptureBytes.
+var ErrOutputTruncated = errors.New("sandbox: output truncated")
+
+// Result holds the outcome of a command executed by Run.
+type Result struct {
+	// Stdout and Stderr contain the output captured from the sandbox tool.
+	Stdout []byte
+	Stderr []byte
+	// ExitCode is the exit code of the sandbox tool, or -1 if it did not exit normally.
+	ExitCode int
+	// Signal is the signal that terminated the sandbox tool, or zero.
+	Signal syscall.Signal
+	// TimedOut reports whether the run context deadline was exceeded.
+	TimedOut bool
+	// Usage holds the statistics saved by the sandbox tool, if SaveUsageStat was set.
+	Usage *UsageStat
+	// MemLimit is the memory limit the run was configured with, or zero.
+	MemLimit uint64
+	// CpuTimeLimit and WallTimeLimit are the "cpu" resource limit and the SetWallTimeLimit limit
+	// the run was configured with, or zero.
+	CpuTimeLimit  time.Duration
+	WallTimeLimit time.Duration
+	// LimitExitCode is the SetLimitExitCode code the run was configured with, or zero.
+	LimitExitCode int
+	// OutputTruncated reports whether output beyond the SetMaxCaptureBytes cap was dropped.
+	OutputTruncated bool
+	// ToolRusage is the resource usage of the sandbox tool process itself, as opposed to Usage,
+	// which describes the sandboxed program. It is nil if the tool did not run.
+	ToolRusage *syscall.Rusage
+}
+
+// SetPreExec registers a hook that Run invokes right before the sandbox tool is started.
+//
+// The hook receives the full sandbox tool argv, including the executable. A nil hook is a no-op.
+func (s *Sandbox) SetPreExec(fn func(argv []string)) *Sandbox {
+	s.preExec = fn
+
+	return s
+}
+
+// SetPostExec registers a hook that Run invokes right after the sandbox tool exits.
+//
+// The hook receives the same result and error that Run returns. A nil hook is a no-op.
+func (s *Sandbox) SetPostExec(fn func(res *Result, err error)) *Sandbox {
+	s.postExec = fn
+
+	return s
+}
+
+// SetStdoutTee makes Run forward the sandbox tool stdout to w while it is being captured.
+func (s *Sandbox) SetStdoutTee(w io.Writer) *Sandbox {
+	s.stdoutTee = w
+
+	return s
+}
+
+// SetStderrTee makes Run forward the sandbox tool stderr to w while it is being captured.
+func (s *Sandbox) SetStderrTee(w io.Writer) *Sandbox {
+	s.stderrTee = w
+
+	return s
+}
+
+// SetMaxCaptureBytes caps how many bytes of stdout and of stderr Run keeps in the Result, to
+// protect the caller from programs that produce unbounded output. Zero or a negative value means
+// no cap. Tee writers still receive the output beyond the cap, unless SetStopOnCaptureOverflow is
+// set.
+//
+// When the cap is hit, Run returns ErrOutputTruncated unless the tool failed to run at all.
+func (s *Sandbox) SetMaxCaptureBytes(n int) *Sandbox {
+	s.maxCapture = n
+
+	return s
+}
+
+// SetStopOnCaptureOverflow configures what happens to output beyond the SetMaxCaptureBytes cap.
+// By default it is read and discarded until the command exits. When v is true, Run stops reading
+// the stream instead, so a program that keeps writing fails with a broken pipe.
+func (s *Sandbox) SetStopOnCaptureOverflow(v bool) *Sandbox {
+	s.stopCapture = v
+
+	return s
+}
+
+// AddCleanup registers a function that the next Run calls once it is done, whether the command
+// exited on its own, failed to start, or was killed because the context was cancelled.
+//
+// Cleanups run in reverse registration order, after the post-exec hook, and are called at most once.
+func (s *Sandbox) AddCleanup(fn func()) *Sandbox {
+	s.cleanups = append(s.cleanups, fn)
+
+	return s
+}
+
+// Run executes a command inside the sandbox, waits for it to finish and returns the captured output.
+//
+// The configuration is checked with ValidateCommand before anything is started. The returned Result is
+// never nil, even when an error is returned, so partial output is always available. If
+// SaveUsageStat is set, the statistics file is parsed into Result.Usage.
+func (s *Sandbox) Run(ctx context.Context, path string, args ...string) (*Result, error) {
+	defer s.runCleanups()
+
+	if err := s.ValidateCommand(path); err != nil {
+		return &Result{ExitCode: -1}, err
+	}
+
+	cmd := s.CommandContext(ctx, path, args...)
+
+	stdout := &captureBuffer{max: s.maxCapture, stop: s.stopCapture}
+	stderr := &captureBuffer{max: s.maxCapture, stop: s.stopCapture}
+	cmd.Stdout = tee(stdout, s.stdoutTee)
+	cmd.Stderr = tee(stderr, s.stderrTee)
+
+	if s.preExec != nil {
+		s.preExec(cmd.Args)
+	}
+
+	err := cmd.Run()
+
+	res := &Result{
+		Stdout:          stdout.buf.Bytes(),
+		Stderr:          stderr.buf.Bytes(),
+		ExitCode:        -1,
+		TimedOut:        ctx != nil && ctx.Err() == context.DeadlineExceeded,
+		MemLimit:        s.memLimit,
+		CpuTimeLimit:    s.cpuTimeLimit(),
+		WallTimeLimit:   s.wallLimit,
+		LimitExitCode:   s.limitExit,
+		OutputTruncated: stdout.truncated || stderr.truncated,
+	}
+
+	var exitErr *exec.ExitError
+	if res.OutputTruncated && (err == nil || errors.As(err, &exitErr) || errors.Is(err, ErrOutputTruncated)) {
+		err = ErrOutputTruncated
+	}
+
+	err = s.collect(res, cmd, err)
+
+	// A program that fills the disk and then fails must still be reported.
+	if budgetErr := s.checkDiskBudget(); budgetErr != nil {
+		if err == nil {
+			err = budgetErr
+		} else {
+			err = &budgetRunError{run: err, budget: budgetErr}
+		}
+	}
+
+	if s.postExec != nil {
+		s.postExec(res, err)
+	}
+
+	return res, err
+}
+
+// collect fills res from the state of the exited tool process and its usage statistics. It
+// returns runErr, or the error reading the statistics if runErr is nil.
+func (s *Sandbox) collect(res *Result, cmd *exec.Cmd, runErr error) error {
+	if cmd.ProcessState == nil {
+		return runErr
+	}
+
+	res.ExitCode = cmd.ProcessState.ExitCode()
+	res.ToolRusage, _ = cmd.ProcessState.SysUsage().(*syscall.Rusage)
+
+	if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		res.Signal = ws.Signal()
+	}
+
+	if s.saveUsageStat != "" {
+		usage, err := ReadUsageStat(s.saveUsageStat)
+		if err == nil {
+			res.Usage = usage
+		} else if runErr == nil {
+			runErr = err
+		}
+	}
+
+	return runErr
+}
+
+// budgetRunError is the error of a failed run that also exceeded the disk budget. It unwraps to
+// the budget error, and Is and As also match the run error.
+type budgetRunError struct {
+	run    error
+	budget error
+}
+
+func (e *budgetRunError) Error() string {
+	return e.run.Error() + "; " + e.budget.Error()
+}
+
+func (e *budgetRunError) Unwrap() error {
+	return e.budget
+}
+
+func (e *budgetRunError) Is(target error) bool {
+	return errors.Is(e.run, target)
+}
+
+func (e *budgetRunError) As(target interface{}) bool {
+	return errors.As(e.run, target)
+}
+
+func (s *Sandbox) runCleanups() {
+	cleanups := s.cleanups
+	s.cleanups = nil
+
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+}
+
+// captureBuffer collects output up to max bytes, if max is positive.
+type captureBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	stop      bool
+	truncated bool
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	if b.max <= 0 {
+		return b.buf.Write(p)
+	}
+
+	room := b.max - b.buf.Len()
+	if len(p) <= room {
+		return b.buf.Write(p)
+	}
+
+	b.buf.Write(p[:room])
+	b.truncated = true
+
+	if b.stop {
+		return room, ErrOutputTruncated
+	}
+
+	return len(p), nil
+}
+
+// tee returns buf alone, or combined with w if w is set. Output always reaches buf first,
+// so it is captured even if writing to w fails.
+func tee(buf io.Writer, w io.Writer) io.Writer {
+	if w == nil {
+		return buf
+	}
+
+	return io.MultiWriter(buf, w)
+}
+
+// Measure runs a command inside the sandbox, discarding its output, and returns only the usage
+// statistics saved by the sandbox tool into a temporary file, which is removed afterwards.
+//
+// The sandbox itself is not modified. If the command fails but statistics were still written,
+// both the statistics and the error are returned.
+func (s *Sandbox) Measure(ctx context.Context, path string, args ...string) (*UsageStat, error) {
+	f, err := os.CreateTemp("", "sandbox-usage-")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	c := s.Clone().SaveUsageStat(f.Name())
+	if err := c.ValidateCommand(path); err != nil {
+		return nil, err
+	}
+
+	runErr := c.CommandContext(ctx, path, args...).Run()
+
+	usage, err := ReadUsageStat(f.Name())
+	if runErr != nil {
+		return usage, runErr
+	}
+
+	return usage, err
+}
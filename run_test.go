@@ -0,0 +1,191 @@
+package sandbox_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+// withToolPath temporarily replaces the sandbox executable, so that tests can run without the real tool.
+func withToolPath(t *testing.T, path string) {
+	prev := sandbox.Path
+	sandbox.Path = path
+	t.Cleanup(func() { sandbox.Path = prev })
+}
+
+func TestRunHooks(t *testing.T) {
+	withToolPath(t, "/bin/echo")
+
+	var argv []string
+	var hookRes *sandbox.Result
+	var hookErr error
+
+	sbox := sandbox.New("/root").
+		SetPreExec(func(a []string) { argv = a }).
+		SetPostExec(func(res *sandbox.Result, err error) { hookRes, hookErr = res, err })
+
+	res, err := sbox.Run(context.Background(), "/bin/true", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(argv) == 0 || argv[0] != "/bin/echo" || !hasArgs(argv, "--", "/bin/true", "x") {
+		t.Fatalf("pre-exec argv: %q", argv)
+	}
+
+	if hookRes != res || hookErr != nil {
+		t.Fatalf("post-exec got %v, %v", hookRes, hookErr)
+	}
+
+	if string(res.Stdout) != "/root -- /bin/true x\n" || res.ExitCode != 0 {
+		t.Fatalf("result: %q, exit code %d", res.Stdout, res.ExitCode)
+	}
+
+	if res.ToolRusage == nil {
+		t.Fatal("missing tool rusage")
+	}
+}
+
+func TestRunNilHooks(t *testing.T) {
+	withToolPath(t, "/bin/false")
+
+	res, err := sandbox.New("/root").Run(context.Background(), "/bin/true")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if res == nil || res.ExitCode != 1 {
+		t.Fatalf("result: %+v", res)
+	}
+}
+
+func TestRunTee(t *testing.T) {
+	withToolPath(t, "/bin/echo")
+
+	var out bytes.Buffer
+	res, err := sandbox.New("/root").SetStdoutTee(&out).Run(context.Background(), "/bin/true")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "/root -- /bin/true\n" || string(res.Stdout) != out.String() {
+		t.Fatalf("tee: %q, captured: %q", out.String(), res.Stdout)
+	}
+}
+
+func TestRunCleanupOnCancel(t *testing.T) {
+	withToolPath(t, "/bin/sleep")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var calls []int
+	sbox := sandbox.New("10").
+		AddCleanup(func() { calls = append(calls, 1) }).
+		AddCleanup(func() { calls = append(calls, 2) })
+
+	if _, err := sbox.Run(ctx, "/bin/true"); err == nil {
+		t.Fatal("expected error from cancelled context")
+	}
+
+	if len(calls) != 2 || calls[0] != 2 || calls[1] != 1 {
+		t.Fatalf("cleanup calls: %v", calls)
+	}
+
+	withToolPath(t, "/bin/true")
+	if _, err := sbox.Run(context.Background(), "/bin/prog"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calls) != 2 {
+		t.Fatalf("cleanups called more than once: %v", calls)
+	}
+}
+
+func TestRunMaxCaptureBytes(t *testing.T) {
+	withToolPath(t, "/bin/echo")
+
+	var out bytes.Buffer
+	res, err := sandbox.New("/root").SetMaxCaptureBytes(5).SetStdoutTee(&out).Run(context.Background(), "/bin/true")
+	if !errors.Is(err, sandbox.ErrOutputTruncated) {
+		t.Fatalf("expected ErrOutputTruncated, got %v", err)
+	}
+
+	if string(res.Stdout) != "/root" || !res.OutputTruncated || res.Classify() != sandbox.OutcomeOutputLimit {
+		t.Fatalf("result: %+v", res)
+	}
+
+	if out.String() != "/root -- /bin/true\n" {
+		t.Fatalf("tee must receive the whole output: %q", out.String())
+	}
+
+	res, err = sandbox.New("/root").SetMaxCaptureBytes(100).Run(context.Background(), "/bin/true")
+	if err != nil || res.OutputTruncated {
+		t.Fatalf("unexpected truncation: %v, %+v", err, res)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	// The fake tool finds the --save_usage_stat value among its arguments and writes statistics there.
+	script := writeFile(t, "tool.sh", `#!/bin/sh
+while [ "$1" != "--save_usage_stat" ]; do shift; done
+echo '{"cpu_time": 42}' > "$2"
+echo noise
+`)
+	if err := os.Chmod(script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	withToolPath(t, script)
+
+	sbox := sandbox.New("/root")
+
+	usage, err := sbox.Measure(context.Background(), "/bin/true")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if usage.CpuTime != 42 {
+		t.Fatalf("usage: %+v", usage)
+	}
+
+	if hasArgs(sbox.BuildExecArgs("/bin/true", nil), "--save_usage_stat") {
+		t.Fatal("Measure modified the sandbox")
+	}
+}
+
+func TestRunWritableDiskBudget(t *testing.T) {
+	dir := t.TempDir()
+
+	script := writeFile(t, "tool.sh", "#!/bin/sh\nhead -c 2048 /dev/zero > "+dir+"/out\n")
+	if err := os.Chmod(script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	withToolPath(t, script)
+
+	sbox := sandbox.New("/root").MountDir(dir, "/out").MountDirReadOnly("/usr", "/usr")
+	if _, err := sbox.SetWritableDiskBudget(4096).Run(context.Background(), "/bin/prog"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sbox.SetWritableDiskBudget(1024).Run(context.Background(), "/bin/prog"); !errors.Is(err, sandbox.ErrDiskBudgetExceeded) {
+		t.Fatalf("expected ErrDiskBudgetExceeded, got %v", err)
+	}
+	// The budget is also checked for failing runs and covers the tmp directory.
+	tmp := t.TempDir()
+	script = writeFile(t, "tool.sh", "#!/bin/sh\nhead -c 2048 /dev/zero > "+tmp+"/out\nexit 1\n")
+	if err := os.Chmod(script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	withToolPath(t, script)
+
+	_, err := sandbox.New("/root").SetTmpDir(tmp).SetWritableDiskBudget(1024).Run(context.Background(), "/bin/prog")
+	var exitErr *exec.ExitError
+	if !errors.Is(err, sandbox.ErrDiskBudgetExceeded) || !errors.As(err, &exitErr) {
+		t.Fatalf("expected ErrDiskBudgetExceeded joined with the exit error, got %v", err)
+	}
+}
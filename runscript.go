@@ -0,0 +1,108 @@
+package sandbox
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GenerateRunScript returns a POSIX shell script that runs path with args in the same sandbox
+// configuration, for handing to users who need to reproduce a run locally. The script runs the
+// sandbox tool at Path, with one flag per line and comments explaining each section.
+//
+// Values of environment variables added with AddSecretEnv are not included: each is replaced by a
+// $SECRET_KEY placeholder, KEY being the variable name with characters other than letters, digits
+// and underscores replaced by underscores, and the script refuses to run until all placeholders
+// are set. The tool environment of SetToolEnv is included as is. Host paths are those of this
+// host, so they may need to be adjusted, and variables added with SetTraceEnvFromContext are
+// omitted.
+func (s *Sandbox) GenerateRunScript(path string, args ...string) string {
+	c := s.Clone()
+
+	// Secret values are replaced by markers that cannot occur in arguments, and the markers by
+	// placeholders once the arguments are quoted.
+	var secrets []string
+	placeholders := make(map[string]string)
+	for i, e := range c.env {
+		if !e.secret {
+			continue
+		}
+
+		name := "SECRET_" + strings.Map(func(r rune) rune {
+			if r == '_' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return '_'
+		}, e.key())
+		if _, ok := placeholders[name]; !ok {
+			secrets = append(secrets, name)
+		}
+
+		marker := fmt.Sprintf("\x00%d\x00", i)
+		placeholders[marker] = name
+		c.env[i].value = e.key() + "=" + marker
+	}
+
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Runs %q inside the sandbox, as configured for the original run.\n", path)
+
+	if len(secrets) != 0 {
+		b.WriteString("\n# Secret environment values are not included; set these variables before running.\n")
+		for _, name := range secrets {
+			fmt.Fprintf(&b, ": \"${%s:?%s must be set}\"\n", name, name)
+		}
+	}
+
+	quote := func(arg string) string {
+		q := shellQuote(arg)
+		for marker, name := range placeholders {
+			q = strings.ReplaceAll(q, marker, `'"${`+name+`}"'`)
+		}
+		// Drop the empty quotes left around a placeholder at either end.
+		if strings.HasPrefix(q, `''"`) {
+			q = q[2:]
+		}
+		if strings.HasSuffix(q, `"''`) {
+			q = q[:len(q)-2]
+		}
+		return q
+	}
+
+	if c.toolEnv != nil {
+		b.WriteString("\n# The sandbox tool runs with exactly the environment of the original run.")
+	}
+	b.WriteString("\n# Arguments: the sandbox root, one configuration flag per line, then the command after the\n")
+	b.WriteString("# separator.\n")
+	b.WriteString("exec")
+	if c.toolEnv != nil {
+		b.WriteString(" env -i")
+		for _, e := range c.toolEnv {
+			b.WriteString(" " + quote(e))
+		}
+	}
+	fmt.Fprintf(&b, " %s", shellQuote(Path))
+
+	flags := c.flagArgs(false)
+	fmt.Fprintf(&b, " \\\n\t%s", quote(flags[0]))
+	for _, group := range splitFlags(flags[1:]) {
+		quoted := make([]string, len(group))
+		for i, arg := range group {
+			quoted[i] = quote(arg)
+		}
+		fmt.Fprintf(&b, " \\\n\t%s", strings.Join(quoted, " "))
+	}
+
+	if c.setupCmd != nil {
+		path, args = c.wrapSetup(path, args)
+	}
+
+	b.WriteString(" \\\n\t")
+	quoted := []string{shellQuote(c.separatorToken()), shellQuote(path)}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	b.WriteString(strings.Join(quoted, " "))
+	b.WriteString("\n")
+
+	return b.String()
+}
@@ -0,0 +1,42 @@
+package sandbox_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestGenerateRunScript(t *testing.T) {
+	withToolPath(t, "/bin/echo")
+
+	script := sandbox.New("/root").
+		AddEnv("USER=judge").
+		AddSecretEnv("API-TOKEN", "s3cr3t").
+		SetMemLimit(1<<20).
+		GenerateRunScript("/bin/prog", "it's")
+
+	if strings.Contains(script, "s3cr3t") {
+		t.Fatalf("script leaks the secret:\n%s", script)
+	}
+	if !strings.HasPrefix(script, "#!/bin/sh\n") || !strings.Contains(script, "--mem_limit 1048576") {
+		t.Fatalf("unexpected script:\n%s", script)
+	}
+
+	if err := exec.Command("/bin/sh", "-c", script).Run(); err == nil {
+		t.Fatal("expected the script to fail without the secret placeholder")
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", script)
+	cmd.Env = []string{"SECRET_API_TOKEN=from-env"}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "/root --env USER=judge --env API-TOKEN=from-env --mem_limit 1048576 -- /bin/prog it's\n"
+	if string(out) != want {
+		t.Fatalf("output:\n got: %q\nwant: %q", out, want)
+	}
+}
@@ -10,14 +10,36 @@ package sandbox
 
 import (
 	"context"
+	"errors"
+	"io"
+	"math"
+	"os"
 	"os/exec"
+	"sort"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 // Path points to the sandbox executable.
 // It is used as the program invoked by exec.Command.
 var Path = "/usr/bin/sandbox"
 
+// execCommandContext creates the sandbox tool process. It can be replaced with SetRunner.
+var execCommandContext = exec.CommandContext
+
+// SetRunner replaces the function used to create the sandbox tool process, for example with a stub
+// that records invocations in tests; see the sandboxtest package. A nil fn restores the default,
+// exec.CommandContext. It must not be called concurrently with building commands.
+func SetRunner(fn func(ctx context.Context, name string, args ...string) *exec.Cmd) {
+	if fn == nil {
+		fn = exec.CommandContext
+	}
+
+	execCommandContext = fn
+}
+
 // Sandbox is a mutable builder that describes how a program should be executed inside a sandbox.
 //
 // It accumulates filesystem mappings, environment configuration, resource limits, and execution
@@ -25,35 +47,140 @@ var Path = "/usr/bin/sandbox"
 type Sandbox struct {
 	path          string
 	files         []file
+	elfLibDepth   int
+	libCache      string
+	libPaths      []string
 	mountDirs     []mountDir
-	env           []string
+	mappingSeq    int
+	preserveOrder bool
+	propagation   PropagationMode
+	env           []envVar
+	envOverride   bool
+	ctxEnv        []ctxEnvVar
+	expandEnv     bool
+	expandHostEnv bool
+	expandStrict  bool
 	noNewNet      bool
+	netNS         string
+	dns           bool
+	namespaces    Namespaces
+	netBandwidth  uint64
 	cgroup        string
 	cpuSet        string
+	nice          *int
 	memLimit      uint64
+	memHigh       uint64
+	pidsMax       uint64
+	rlimits       []rlimit
+	cpuMaxQuota   uint64
+	cpuMaxPeriod  uint64
+	oomScoreAdj   *int
+	uids          *[3]int
+	capSet        []string
+	coreDumpPath  string
+	syscallTrace  string
+	lockMemory    bool
+	limitExit     int
+	schedPolicy   SchedPolicy
+	schedPriority int
+	allowRealtime bool
 	saveUsageStat string
+	statInterval  time.Duration
+	setupLimit    time.Duration
+	wallLimit     time.Duration
+	limitSignal   syscall.Signal
+	timeOffset    time.Duration
 	execDir       string
+	tmpDir        string
+	chrootDir     string
+	readOnlyRoot  bool
+	writable      []string
+	killChildren  *bool
+	verbosity     int
+	setupCmd      []string
+	separator     string
+	configFile    string
+	labels        [][2]string
+	sysctls       [][2]string
+	preExec       func(argv []string)
+	postExec      func(res *Result, err error)
+	stdoutTee     io.Writer
+	stderrTee     io.Writer
+	cleanups      []func()
+	maxCapture    int
+	diskBudget    uint64
+	stopCapture   bool
+	toolEnv       []string
+	newPgrp       bool
+	foreground    bool
+	allocPTY      bool
+
+	rejectSymlinks bool
+	srcPrefixes    []string
+	dstPrefixes    []string
+	checkSources   bool
+	noNesting      bool
+	strictFlags    bool
 }
 
 type file struct {
 	src      string
 	dst      string
 	withLibs bool
+	optional bool
+	// seq orders files and directory mounts by insertion, see SetPreserveInsertionOrder.
+	seq int
+}
+
+// skipped reports whether the file is optional and its source does not exist.
+func (f file) skipped() bool {
+	if !f.optional {
+		return false
+	}
+
+	_, err := os.Stat(f.src)
+
+	return errors.Is(err, os.ErrNotExist)
+}
+
+type envVar struct {
+	value  string
+	secret bool
+}
+
+// DirMapping describes a host directory mounted inside the sandbox.
+type DirMapping struct {
+	Src      string
+	Dst      string
+	ReadOnly bool
+	// Quota is the maximum number of bytes that may be written to a writable mount, or zero.
+	Quota uint64
+	// UIDMap and GIDMap make the mount ID-mapped, see MountDirIDMap.
+	UIDMap []IDMapEntry
+	GIDMap []IDMapEntry
 }
 
 type mountDir struct {
-	src string
-	dst string
+	src      string
+	dst      string
+	readOnly bool
+	quota    uint64
+	uidMap   string
+	gidMap   string
+	seq      int
 }
 
 // New creates a new sandbox configuration for the given sandbox root path.
+//
+// The root path is the host directory the sandbox tool prepares: files and directories are
+// added under it and it is used as the process root unless SetChrootDir selects a subdirectory.
 func New(path string) *Sandbox {
 	return &Sandbox{path: path}
 }
 
 // AddFile declares that a file from the host must be available inside the sandbox at the given location.
 func (s *Sandbox) AddFile(src, dst string, withLibs bool) *Sandbox {
-	s.files = append(s.files, file{
+	s.appendFile(file{
 		src:      src,
 		dst:      dst,
 		withLibs: withLibs,
@@ -62,9 +189,81 @@ func (s *Sandbox) AddFile(src, dst string, withLibs bool) *Sandbox {
 	return s
 }
 
+// SetPreserveInsertionOrder makes the files and directory mounts be passed to the sandbox tool in
+// the exact order their setters were called, interleaved, so that callers control the order in
+// which nested mappings are applied, e.g. a directory mount of /a followed by a file added at
+// /a/b. By default all files are passed first, then all directory mounts, each in insertion order.
+// When it is set, the files added by EnableDNS come before all other mappings.
+func (s *Sandbox) SetPreserveInsertionOrder(v bool) *Sandbox {
+	s.preserveOrder = v
+
+	return s
+}
+
+func (s *Sandbox) appendFile(f file) {
+	s.mappingSeq++
+	f.seq = s.mappingSeq
+	s.files = append(s.files, f)
+}
+
+func (s *Sandbox) appendMountDir(d mountDir) {
+	s.mappingSeq++
+	d.seq = s.mappingSeq
+	s.mountDirs = append(s.mountDirs, d)
+}
+
+// AddFileOptional is identical to AddFile, but the file is only added if src exists when the
+// command is built. A missing source is skipped with a warning instead of making the sandbox tool
+// fail, and it is not reported by Validate.
+func (s *Sandbox) AddFileOptional(src, dst string, withLibs bool) *Sandbox {
+	s.appendFile(file{
+		src:      src,
+		dst:      dst,
+		withLibs: withLibs,
+		optional: true,
+	})
+
+	return s
+}
+
+// SetElfLibDepth limits how many levels of shared library dependencies the sandbox tool resolves
+// for files added with AddFile and withLibs set: 1 means only the direct dependencies of each
+// file. Zero, the default, means no limit.
+//
+// Libraries beyond the limit are not added, so the program fails to load if it needs them; add
+// such libraries explicitly with AddFile instead.
+func (s *Sandbox) SetElfLibDepth(n int) *Sandbox {
+	s.elfLibDepth = n
+
+	return s
+}
+
+// SetLibCache makes the sandbox tool cache the shared library dependencies it resolves for files
+// added with withLibs in the host file path, so that repeated runs of the same binaries skip the
+// lookup. An empty path, the default, disables the cache.
+func (s *Sandbox) SetLibCache(path string) *Sandbox {
+	s.libCache = path
+
+	return s
+}
+
+// SetLibSearchPaths sets the host directories in which the sandbox tool looks up the shared
+// library dependencies of files added with AddFile and withLibs set, in order, instead of the
+// default host library paths, much like LD_LIBRARY_PATH does for the dynamic loader. It replaces
+// any earlier list; no paths means the default lookup.
+//
+// It only affects which host libraries are added to the sandbox, not the search path of the
+// sandboxed program: libraries are added at the paths the program expects, so files added without
+// withLibs and programs loading libraries at runtime are not affected.
+func (s *Sandbox) SetLibSearchPaths(paths ...string) *Sandbox {
+	s.libPaths = append([]string(nil), paths...)
+
+	return s
+}
+
 // MountDir declares that a directory from the host filesystem must be accessible inside the sandbox.
 func (s *Sandbox) MountDir(src, dst string) *Sandbox {
-	s.mountDirs = append(s.mountDirs, mountDir{
+	s.appendMountDir(mountDir{
 		src: src,
 		dst: dst,
 	})
@@ -72,20 +271,213 @@ func (s *Sandbox) MountDir(src, dst string) *Sandbox {
 	return s
 }
 
+// MountDirReadOnly is identical to MountDir, but the directory is mounted read-only.
+func (s *Sandbox) MountDirReadOnly(src, dst string) *Sandbox {
+	s.appendMountDir(mountDir{
+		src:      src,
+		dst:      dst,
+		readOnly: true,
+	})
+
+	return s
+}
+
+// MountDirQuota is identical to MountDir, but at most maxBytes may be written to the directory
+// from inside the sandbox. The sandbox tool enforces the quota by backing the mount with a
+// project quota on the host filesystem, which must support them (XFS, or ext4 mounted with
+// prjquota); otherwise the tool fails. A zero maxBytes means no quota.
+//
+// If the written data does not need to reach the host, a size-limited tmpfs is cheaper and works
+// on any filesystem.
+func (s *Sandbox) MountDirQuota(src, dst string, maxBytes uint64) *Sandbox {
+	s.appendMountDir(mountDir{
+		src:   src,
+		dst:   dst,
+		quota: maxBytes,
+	})
+
+	return s
+}
+
+// MountDirMulti mounts the same host directory at each of the given destinations, as repeated
+// MountDir calls would.
+func (s *Sandbox) MountDirMulti(src string, dsts ...string) *Sandbox {
+	for _, dst := range dsts {
+		s.MountDir(src, dst)
+	}
+
+	return s
+}
+
+// MountDirMultiReadOnly is identical to MountDirMulti, but every mount is read-only.
+func (s *Sandbox) MountDirMultiReadOnly(src string, dsts ...string) *Sandbox {
+	for _, dst := range dsts {
+		s.MountDirReadOnly(src, dst)
+	}
+
+	return s
+}
+
+// MountDirs mounts every directory in dirs, in order, as MountDir, MountDirReadOnly,
+// MountDirQuota or MountDirIDMap would.
+func (s *Sandbox) MountDirs(dirs ...DirMapping) *Sandbox {
+	for _, d := range dirs {
+		s.appendMountDir(mountDir{
+			src:      d.Src,
+			dst:      d.Dst,
+			readOnly: d.ReadOnly,
+			quota:    d.Quota,
+			uidMap:   formatIDMap(d.UIDMap),
+			gidMap:   formatIDMap(d.GIDMap),
+		})
+	}
+
+	return s
+}
+
+// Mounts returns the directory mounts configured so far, in the order they were added.
+func (s *Sandbox) Mounts() []DirMapping {
+	dirs := make([]DirMapping, len(s.mountDirs))
+	for i, d := range s.mountDirs {
+		dirs[i] = DirMapping{Src: d.src, Dst: d.dst, ReadOnly: d.readOnly, Quota: d.quota}
+		dirs[i].UIDMap, _ = parseIDMap(d.uidMap)
+		dirs[i].GIDMap, _ = parseIDMap(d.gidMap)
+	}
+
+	return dirs
+}
+
+// Destinations returns the sandbox paths of every file and directory mapping, including the files
+// added by EnableDNS and the /tmp mount of SetTmpDir, in sorted order. Optional files whose source
+// is missing are left out. Duplicates are kept, so that callers can detect them.
+func (s *Sandbox) Destinations() []string {
+	var dsts []string
+	for _, m := range s.mappings() {
+		dsts = append(dsts, m.dst)
+	}
+
+	sort.Strings(dsts)
+
+	return dsts
+}
+
+// Dedup removes file and directory mappings that exactly duplicate an earlier one, with the same
+// source, destination and options, keeping the first occurrence.
+func (s *Sandbox) Dedup() *Sandbox {
+	seenFiles := make(map[file]bool, len(s.files))
+	files := s.files[:0]
+	for _, f := range s.files {
+		key := f
+		key.seq = 0
+		if !seenFiles[key] {
+			seenFiles[key] = true
+			files = append(files, f)
+		}
+	}
+	s.files = files
+
+	seenDirs := make(map[mountDir]bool, len(s.mountDirs))
+	dirs := s.mountDirs[:0]
+	for _, d := range s.mountDirs {
+		key := d
+		key.seq = 0
+		if !seenDirs[key] {
+			seenDirs[key] = true
+			dirs = append(dirs, d)
+		}
+	}
+	s.mountDirs = dirs
+
+	return s
+}
+
 // AddEnv adds an environment variable that will be visible to the sandboxed process.
 func (s *Sandbox) AddEnv(value string) *Sandbox {
-	s.env = append(s.env, value)
+	return s.addEnv(envVar{value: value})
+}
+
+// AddEnvKV adds an environment variable given as a separate key and value.
+func (s *Sandbox) AddEnvKV(key, value string) *Sandbox {
+	return s.AddEnv(key + "=" + value)
+}
+
+// AddSecretEnv adds an environment variable whose value is redacted by CommandLine.
+//
+// The variable is passed to the sandboxed process exactly like one added with AddEnvKV.
+func (s *Sandbox) AddSecretEnv(key, value string) *Sandbox {
+	return s.addEnv(envVar{value: key + "=" + value, secret: true})
+}
+
+// SetEnvOverride configures what adding a variable whose key is already set does. By default it
+// is appended, and both definitions are passed to the tool. When v is true, the new definition
+// replaces the first earlier one in place instead and any other earlier ones are dropped, so the
+// last value wins and the key is emitted once. Duplicates added before SetEnvOverride is enabled
+// are only collapsed once the key is added again.
+func (s *Sandbox) SetEnvOverride(v bool) *Sandbox {
+	s.envOverride = v
+
+	return s
+}
+
+func (s *Sandbox) addEnv(e envVar) *Sandbox {
+	if s.envOverride {
+		key := e.key()
+		replaced := false
+		env := s.env[:0]
+		for _, old := range s.env {
+			switch {
+			case old.key() != key:
+				env = append(env, old)
+			case !replaced:
+				env = append(env, e)
+				replaced = true
+			}
+		}
+		s.env = env
+
+		if replaced {
+			return s
+		}
+	}
+
+	s.env = append(s.env, e)
 
 	return s
 }
 
 // SetNoNewNet configures whether the sandboxed process is isolated from the network.
+//
+// It is equivalent to toggling NamespaceNet with SetNamespaces.
 func (s *Sandbox) SetNoNewNet(v bool) *Sandbox {
 	s.noNewNet = v
 
 	return s
 }
 
+// dnsFiles are the host files EnableDNS makes available inside the sandbox.
+var dnsFiles = []string{"/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf"}
+
+// EnableDNS makes name resolution work inside the sandbox by adding the host's /etc/resolv.conf,
+// /etc/hosts and /etc/nsswitch.conf at the same paths.
+//
+// The files are only added if the process has network access: when SetNoNewNet(true) is set as
+// well, EnableDNS has no effect and a warning is reported through Warnf when the command is created.
+func (s *Sandbox) EnableDNS() *Sandbox {
+	s.dns = true
+
+	return s
+}
+
+// SetNetBandwidth limits the network bandwidth available to the sandboxed process, in bytes per second.
+//
+// The limit only has an effect when the process has network access; it is ignored by the sandbox
+// tool when networking is disabled with SetNoNewNet. A zero value means no limit.
+func (s *Sandbox) SetNetBandwidth(bytesPerSec uint64) *Sandbox {
+	s.netBandwidth = bytesPerSec
+
+	return s
+}
+
 // SetCGroup assigns the sandboxed process to a control group.
 func (s *Sandbox) SetCGroup(name string) *Sandbox {
 	s.cgroup = name
@@ -100,6 +492,16 @@ func (s *Sandbox) SetCpuSet(set string) *Sandbox {
 	return s
 }
 
+// SetNice sets the nice value of the sandboxed process, within [-20, 19].
+//
+// Like the CPU set, it is applied by the sandbox tool before the command is executed, so the
+// process never runs with the default priority or affinity.
+func (s *Sandbox) SetNice(n int) *Sandbox {
+	s.nice = &n
+
+	return s
+}
+
 // SetMemLimit limits memory usage of the sandboxed process.
 func (s *Sandbox) SetMemLimit(limit uint64) *Sandbox {
 	s.memLimit = limit
@@ -107,6 +509,126 @@ func (s *Sandbox) SetMemLimit(limit uint64) *Sandbox {
 	return s
 }
 
+// SetMemMax sets the hard memory limit (cgroup memory.max) of the sandboxed process, in bytes.
+// Reaching it triggers the OOM killer. It is an alias of SetMemLimit.
+func (s *Sandbox) SetMemMax(bytes uint64) *Sandbox {
+	return s.SetMemLimit(bytes)
+}
+
+// SetMemHigh sets the soft memory limit (cgroup memory.high) of the sandboxed process, in bytes.
+//
+// Above it the process is throttled and its memory aggressively reclaimed, but not killed. It is
+// usually set below the hard limit, so that the process slows down before it is OOM-killed.
+func (s *Sandbox) SetMemHigh(bytes uint64) *Sandbox {
+	s.memHigh = bytes
+
+	return s
+}
+
+// SetPidLimit caps the number of processes and threads that may exist in the sandbox at once
+// (cgroup pids.max). Zero means no limit. Unlike the "nproc" resource limit, it counts only the
+// tasks of the sandbox, not every process of the same user on the host.
+//
+// The pids controller has no notion of rate: a fork bomb that stays under the cap is not slowed
+// down. Keep the cap low and combine it with CPU limits, which bound how fast tasks can be created.
+func (s *Sandbox) SetPidLimit(n uint64) *Sandbox {
+	s.pidsMax = n
+
+	return s
+}
+
+// SetCpuMax limits the aggregate CPU bandwidth of all threads of the sandboxed process through the
+// cgroup v2 cpu.max controller.
+//
+// The process may consume at most quotaMicros of CPU time every periodMicros, summed across all
+// CPUs: 50000/100000 allows half a core, 200000/100000 allows two full cores. A zero quota means
+// no limit, and a zero period defaults to 100000, the kernel default.
+func (s *Sandbox) SetCpuMax(quotaMicros, periodMicros uint64) *Sandbox {
+	if periodMicros == 0 {
+		periodMicros = defaultCpuMaxPeriod
+	}
+
+	s.cpuMaxQuota = quotaMicros
+	s.cpuMaxPeriod = periodMicros
+
+	return s
+}
+
+// SetOOMScoreAdj sets the oom_score_adj of the sandboxed process, which influences how the kernel
+// picks a victim when the whole host runs out of memory.
+//
+// The value must be within [-1000, 1000]; higher values make the process a more likely victim.
+// It is unrelated to the cgroup memory limit set by SetMemLimit.
+func (s *Sandbox) SetOOMScoreAdj(adj int) *Sandbox {
+	s.oomScoreAdj = &adj
+
+	return s
+}
+
+// SetUIDs runs the sandboxed process with the given real, effective and saved user IDs, which may
+// differ, e.g. to test how a program drops privileges. -1 leaves the corresponding ID as the
+// sandbox tool sets it, and only the IDs that are not -1 are passed to the tool.
+func (s *Sandbox) SetUIDs(ruid, euid, suid int) *Sandbox {
+	s.uids = &[3]int{ruid, euid, suid}
+
+	return s
+}
+
+// SetCoreDumpPath makes the sandbox tool save core dumps of the sandboxed process into the host
+// directory path, and lifts the "core" resource limit so that they are written at all. An empty
+// path disables saving, but leaves the resource limit as it is.
+//
+// Core dumps contain the whole memory of the process, and writing them takes time and disk space
+// that are not bounded by the sandbox limits. Use it only for trusted programs, when debugging.
+func (s *Sandbox) SetCoreDumpPath(path string) *Sandbox {
+	s.coreDumpPath = path
+	if path != "" {
+		s.SetRlimit("core", math.MaxUint64)
+	}
+
+	return s
+}
+
+// SetLockMemory makes the sandbox tool lock all current and future pages of the sandboxed process
+// in memory, as mlockall(2) does, so that they are prefaulted and never swapped out, and lifts the
+// "memlock" resource limit to allow it. Disabling it leaves the resource limit as it is.
+//
+// Locked pages are charged to the memory limit like any other, so with SetMemLimit a program
+// that locks its whole address space reaches the limit as soon as it maps the memory, not when it
+// first touches it.
+func (s *Sandbox) SetLockMemory(v bool) *Sandbox {
+	s.lockMemory = v
+	if v {
+		s.SetRlimit("memlock", math.MaxUint64)
+	}
+
+	return s
+}
+
+// SetSyscallTrace makes the sandbox tool trace the system calls of the sandboxed process and its
+// children, in the style of strace -f, into the host file path. An empty path disables tracing.
+//
+// Every traced system call stops the process twice, so system-call heavy programs can run many
+// times slower and time measurements are meaningless. Use it only to diagnose failures.
+func (s *Sandbox) SetSyscallTrace(path string) *Sandbox {
+	s.syscallTrace = path
+
+	return s
+}
+
+// SetLimitExitCode sets the exit code, within [1, 255], that the sandbox tool reports when it
+// terminates the process for exceeding a time or memory limit, instead of the process's own
+// status. Zero keeps the tool default.
+//
+// The library passes a single code for all limits. Result.Classify recognizes it and tells a
+// memory limit from a time limit by comparing the peak memory of the usage statistics, if any,
+// against MemLimit.
+func (s *Sandbox) SetLimitExitCode(code int) *Sandbox {
+	s.limitExit = code
+
+	return s
+}
+
 // SaveUsageStat enables persisting execution statistics after the process exits.
 func (s *Sandbox) SaveUsageStat(filename string) *Sandbox {
 	s.saveUsageStat = filename
@@ -114,6 +636,59 @@ func (s *Sandbox) SaveUsageStat(filename string) *Sandbox {
 	return s
 }
 
+// SetUsageStatInterval makes the sandbox tool rewrite the SaveUsageStat file every d while the
+// process is running, in addition to the final statistics written on exit. Use WatchUsageStat to
+// follow the snapshots. The interval is passed with millisecond precision.
+func (s *Sandbox) SetUsageStatInterval(d time.Duration) *Sandbox {
+	s.statInterval = d
+
+	return s
+}
+
+// SetSetupTimeLimit bounds the time the sandbox tool may spend preparing the sandbox, such as
+// adding files and mounting directories, before it starts the command. The program's own runtime
+// is not counted. The limit is passed with millisecond precision; zero means no limit.
+func (s *Sandbox) SetSetupTimeLimit(d time.Duration) *Sandbox {
+	s.setupLimit = d
+
+	return s
+}
+
+// SetWallTimeLimit makes the sandbox tool kill the sandboxed process once it has been running for
+// d of real time, whether or not it uses the CPU. The limit is passed with millisecond precision;
+// zero means no limit.
+func (s *Sandbox) SetWallTimeLimit(d time.Duration) *Sandbox {
+	s.wallLimit = d
+
+	return s
+}
+
+// SetTimeLimitSignal makes the sandbox tool terminate the sandboxed process with sig, instead of
+// its default SIGKILL, when a time limit enforced by the tool is exceeded, so that a program can
+// catch e.g. SIGTERM and flush its output. Zero restores the default.
+//
+// This only affects termination by the tool itself. When the context passed to Run or
+// CommandContext is done, the Go side kills the sandbox tool process with SIGKILL regardless of
+// this setting.
+func (s *Sandbox) SetTimeLimitSignal(sig syscall.Signal) *Sandbox {
+	s.limitSignal = sig
+
+	return s
+}
+
+// SetTimeOffset runs the sandboxed process in a time namespace whose monotonic and boot-time
+// clocks are shifted by d, so that the uptime seen by the process does not depend on the host.
+//
+// Time namespaces require Linux 5.6 or newer and cannot virtualize the wall clock: CLOCK_REALTIME,
+// and therefore time(2) and gettimeofday(2), still report the host time. Freezing the wall clock
+// requires tools such as libfaketime, which can be added with AddFile and AddEnv. The offset is
+// passed with millisecond precision.
+func (s *Sandbox) SetTimeOffset(d time.Duration) *Sandbox {
+	s.timeOffset = d
+
+	return s
+}
+
 // ExecDir sets the working directory inside the sandbox where the command will be executed.
 func (s *Sandbox) ExecDir(dir string) *Sandbox {
 	s.execDir = dir
@@ -121,6 +696,130 @@ func (s *Sandbox) ExecDir(dir string) *Sandbox {
 	return s
 }
 
+// SetTmpDir mounts a host directory as the writable /tmp of the sandboxed process, so temporary
+// files are stored on disk rather than in memory.
+//
+// Files written there stay on the host after the run; removing them is the caller's
+// responsibility, for example with AddCleanup.
+func (s *Sandbox) SetTmpDir(hostPath string) *Sandbox {
+	s.tmpDir = hostPath
+
+	return s
+}
+
+// SetChrootDir sets the directory, relative to the sandbox root passed to New, that the sandboxed
+// process sees as "/".
+//
+// When unset, the process is chrooted to the sandbox root itself.
+func (s *Sandbox) SetChrootDir(dir string) *Sandbox {
+	s.chrootDir = dir
+
+	return s
+}
+
+// SetReadOnlyRootWithWritable makes the whole sandbox root read-only, except for the listed
+// destination paths, which stay writable.
+//
+// Files and directories added to the sandbox remain visible. Validate reports writable paths that
+// are not absolute or that lie within a read-only directory mount.
+func (s *Sandbox) SetReadOnlyRootWithWritable(writable ...string) *Sandbox {
+	s.readOnlyRoot = true
+	s.writable = append([]string(nil), writable...)
+
+	return s
+}
+
+// SetKillChildrenOnExit configures whether processes left behind by the sandboxed program are
+// killed when it exits. Unless it is called, the sandbox tool default applies.
+func (s *Sandbox) SetKillChildrenOnExit(v bool) *Sandbox {
+	s.killChildren = &v
+
+	return s
+}
+
+// SetVerbosity sets how much the sandbox tool itself reports on stderr, such as its setup
+// diagnostics. Zero, the default, keeps the tool's default output; negative levels make it quieter,
+// with -1 limiting it to errors, and positive levels make it more verbose for debugging. The output
+// of the sandboxed program is not affected.
+func (s *Sandbox) SetVerbosity(level int) *Sandbox {
+	s.verbosity = level
+
+	return s
+}
+
+// SetSetupCommand configures a command that runs inside the sandbox, with the same isolation,
+// right before the main command. The main command only runs if the setup command succeeds.
+//
+// It is implemented by wrapping both commands into "/bin/sh -c", so a POSIX shell must be
+// available at /bin/sh inside the sandbox. The main command is passed as positional parameters and
+// executed with exec, so its arguments are never re-parsed by the shell. Calling it with an empty
+// path removes the setup command.
+func (s *Sandbox) SetSetupCommand(path string, args ...string) *Sandbox {
+	if path == "" {
+		s.setupCmd = nil
+	} else {
+		s.setupCmd = append([]string{path}, args...)
+	}
+
+	return s
+}
+
+// SetLabel attaches a key=value label to the run, for example a submission ID. The sandbox tool
+// records labels for host-side accounting and auditing; they are not visible to the sandboxed
+// process. Setting the same key again replaces its value.
+func (s *Sandbox) SetLabel(key, value string) *Sandbox {
+	for i := range s.labels {
+		if s.labels[i][0] == key {
+			s.labels[i][1] = value
+			return s
+		}
+	}
+
+	s.labels = append(s.labels, [2]string{key, value})
+
+	return s
+}
+
+// SetSeparatorToken sets the token that separates sandbox tool flags from the command, for tool
+// variants that do not use the default "--". An empty token restores the default.
+func (s *Sandbox) SetSeparatorToken(tok string) *Sandbox {
+	s.separator = tok
+
+	return s
+}
+
+// SetToolEnv sets the environment of the sandbox tool process itself to exactly the given entries.
+//
+// This is unrelated to the environment of the sandboxed program, configured with AddEnv. A nil
+// slice, the default, makes the tool inherit the environment of the current process.
+func (s *Sandbox) SetToolEnv(env []string) *Sandbox {
+	if env == nil {
+		s.toolEnv = nil
+	} else {
+		s.toolEnv = append([]string{}, env...)
+	}
+
+	return s
+}
+
+// SetNewProcessGroup starts the sandbox tool in a new process group, so that signals sent to the
+// caller's process group, such as Ctrl-C in a terminal, do not reach it.
+func (s *Sandbox) SetNewProcessGroup(v bool) *Sandbox {
+	s.newPgrp = v
+
+	return s
+}
+
+// SetForeground starts the sandbox tool in a new process group and makes it the foreground
+// process group of the controlling terminal. The terminal is the descriptor cmd.SysProcAttr.Ctty
+// of the calling process, not of the child: descriptor 0, the caller's stdin, by default. Set Ctty
+// to the descriptor of an open terminal if stdin is not one.
+func (s *Sandbox) SetForeground(v bool) *Sandbox {
+	s.foreground = v
+
+	return s
+}
+
 // Command constructs an exec.Cmd that runs a command inside the configured sandbox.
 func (s *Sandbox) Command(path string, args ...string) *exec.Cmd {
 	return s.CommandContext(nil, path, args...)
@@ -128,41 +827,170 @@ func (s *Sandbox) Command(path string, args ...string) *exec.Cmd {
 
 // CommandContext is identical to Command, but allows the execution to be bound to a context.
 func (s *Sandbox) CommandContext(ctx context.Context, path string, args ...string) *exec.Cmd {
-	execArgs := s.BuildExecArgs(path, args)
+	if cmd := devModeCmd(ctx, path, args); cmd != nil {
+		return cmd
+	}
+
+	return s.newCmd(ctx, s.BuildExecArgs(path, args))
+}
+
+// CommandSlice is identical to CommandContext, but takes the command as a single argv slice:
+// argv[0] is the path and the rest are the arguments. It returns an error if argv is empty.
+func (s *Sandbox) CommandSlice(ctx context.Context, argv []string) (*exec.Cmd, error) {
+	if len(argv) == 0 {
+		return nil, errors.New("sandbox: empty command")
+	}
+
+	return s.CommandContext(ctx, argv[0], argv[1:]...), nil
+}
+
+// CommandArgv0 is identical to CommandContext, but the program receives argv0 as argv[0] instead
+// of path, which multi-call binaries such as busybox use to select the applet. It is passed with
+// the --argv0 flag.
+//
+// The shell wrapper of SetSetupCommand cannot preserve argv[0], so argv0 is ignored, with a
+// warning, if a setup command is set.
+func (s *Sandbox) CommandArgv0(ctx context.Context, path, argv0 string, args ...string) *exec.Cmd {
+	if s.setupCmd != nil {
+		warnf("argv0 %q is ignored because a setup command is set", argv0)
+		return s.CommandContext(ctx, path, args...)
+	}
+
+	execArgs := s.flagArgs(false)
+	execArgs = append(execArgs, "--argv0", argv0, s.separatorToken(), path)
+	execArgs = append(execArgs, args...)
 
+	return s.newCmd(ctx, execArgs)
+}
+
+// newCmd creates the sandbox tool command for the given arguments, adding the variables of
+// SetTraceEnvFromContext if ctx is not nil.
+func (s *Sandbox) newCmd(ctx context.Context, execArgs []string) *exec.Cmd {
 	if ctx == nil {
-		return exec.Command(Path, execArgs...)
+		ctx = context.Background()
+	} else if len(s.ctxEnv) != 0 {
+		// Flags may come in any order, so the root is followed by the context variables.
+		execArgs = append(append([]string{execArgs[0]}, s.contextEnvFlags(ctx)...), execArgs[1:]...)
+	}
+
+	if s.dns && s.noNewNet {
+		warnf("EnableDNS is ignored because networking is disabled by SetNoNewNet")
+	}
+
+	cmd := execCommandContext(ctx, Path, execArgs...)
+
+	if s.toolEnv != nil {
+		cmd.Env = append([]string{}, s.toolEnv...)
 	}
 
-	return exec.CommandContext(ctx, Path, execArgs...)
+	if s.newPgrp || s.foreground {
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Setpgid:    s.newPgrp || s.foreground,
+			Foreground: s.foreground,
+		}
+	}
+
+	return cmd
+}
+
+// CommandLine renders the full sandbox tool invocation as a shell command line, suitable for logging.
+//
+// Values of environment variables added with AddSecretEnv are replaced with "***".
+func (s *Sandbox) CommandLine(path string, args ...string) string {
+	argv := append([]string{Path}, s.buildExecArgs(path, args, true)...)
+
+	quoted := make([]string, len(argv))
+	for i, a := range argv {
+		quoted[i] = shellQuote(a)
+	}
+
+	return strings.Join(quoted, " ")
 }
 
 // BuildExecArgs converts the sandbox configuration into a complete argument list for the sandbox executable.
+//
+// All configuration flags, including CPU affinity and scheduling, precede the command separator:
+// the sandbox tool applies them before it executes the command.
 func (s *Sandbox) BuildExecArgs(path string, args []string) []string {
+	return s.buildExecArgs(path, args, false)
+}
+
+func (s *Sandbox) buildExecArgs(path string, args []string, redact bool) []string {
+	if s.setupCmd != nil {
+		path, args = s.wrapSetup(path, args)
+	}
+
+	execArgs := s.flagArgs(redact)
+	execArgs = append(execArgs, s.separatorToken(), path)
+	execArgs = append(execArgs, args...)
+	return execArgs
+}
+
+// buildFlags returns the sandbox root followed by the configuration flags, without the command.
+func (s *Sandbox) buildFlags(redact bool) []string {
 	execArgs := []string{s.path}
 
-	for _, f := range s.files {
-		if f.withLibs {
-			execArgs = append(execArgs, "--add_elf_file")
-		} else {
-			execArgs = append(execArgs, "--add_file")
-		}
+	files, dirs := s.files, s.mountDirs
+	if !s.preserveOrder {
+		execArgs = s.mappingArgs(execArgs, files, nil)
+		files = nil
+	}
+
+	if s.elfLibDepth != 0 {
+		execArgs = append(execArgs, "--elf_lib_depth", strconv.Itoa(s.elfLibDepth))
+	}
+
+	if s.libCache != "" {
+		execArgs = append(execArgs, "--lib_cache", s.libCache)
+	}
+
+	for _, p := range s.libPaths {
+		execArgs = append(execArgs, "--lib_search_path", p)
+	}
 
-		execArgs = append(execArgs, f.src, f.dst)
+	if s.dns && !s.noNewNet {
+		for _, f := range dnsFiles {
+			execArgs = append(execArgs, "--add_file", f, f)
+		}
 	}
 
+	execArgs = s.mappingArgs(execArgs, files, dirs)
+
 	for _, d := range s.mountDirs {
-		execArgs = append(execArgs, "--mount_dir", d.src, d.dst)
+		if d.uidMap != "" {
+			execArgs = append(execArgs, "--uid_map", d.dst, d.uidMap)
+		}
+
+		if d.gidMap != "" {
+			execArgs = append(execArgs, "--gid_map", d.dst, d.gidMap)
+		}
+	}
+
+	if s.propagation != "" {
+		execArgs = append(execArgs, "--mount_propagation", string(s.propagation))
 	}
 
-	for _, e := range s.env {
-		execArgs = append(execArgs, "--env", e)
+	env, _ := s.resolvedEnv()
+	for _, e := range env {
+		execArgs = append(execArgs, "--env", e.render(redact))
 	}
 
 	if s.noNewNet {
 		execArgs = append(execArgs, "--no_new_net")
 	}
 
+	if s.netNS != "" {
+		execArgs = append(execArgs, "--net_ns", s.netNS)
+	}
+
+	if s.namespaces != 0 {
+		execArgs = append(execArgs, "--unshare", s.namespaces.String())
+	}
+
+	if s.netBandwidth != 0 {
+		execArgs = append(execArgs, "--net_bandwidth", strconv.FormatUint(s.netBandwidth, 10))
+	}
+
 	if s.cgroup != "" {
 		execArgs = append(execArgs, "--cgroup", s.cgroup)
 	}
@@ -171,19 +999,219 @@ func (s *Sandbox) BuildExecArgs(path string, args []string) []string {
 		execArgs = append(execArgs, "--cpuset", s.cpuSet)
 	}
 
+	if s.nice != nil {
+		execArgs = append(execArgs, "--nice", strconv.Itoa(*s.nice))
+	}
+
 	if s.memLimit != 0 {
 		execArgs = append(execArgs, "--mem_limit", strconv.FormatUint(s.memLimit, 10))
 	}
 
+	if s.memHigh != 0 {
+		execArgs = append(execArgs, "--mem_high", strconv.FormatUint(s.memHigh, 10))
+	}
+
+	if s.pidsMax != 0 {
+		execArgs = append(execArgs, "--pids_max", strconv.FormatUint(s.pidsMax, 10))
+	}
+
+	for _, r := range s.rlimits {
+		execArgs = append(execArgs, "--rlimit", r.String())
+	}
+
+	if s.cpuMaxQuota != 0 {
+		execArgs = append(execArgs, "--cpu_max",
+			strconv.FormatUint(s.cpuMaxQuota, 10), strconv.FormatUint(s.cpuMaxPeriod, 10))
+	}
+
+	if s.oomScoreAdj != nil {
+		execArgs = append(execArgs, "--oom_score_adj", strconv.Itoa(*s.oomScoreAdj))
+	}
+
+	if s.capSet != nil {
+		execArgs = append(execArgs, "--cap_bounding_set", strings.Join(s.capSet, ","))
+	}
+
+	if s.uids != nil {
+		for i, flag := range uidFlags {
+			if s.uids[i] != -1 {
+				execArgs = append(execArgs, flag, strconv.Itoa(s.uids[i]))
+			}
+		}
+	}
+
+	if s.coreDumpPath != "" {
+		execArgs = append(execArgs, "--core_dump_path", s.coreDumpPath)
+	}
+
+	if s.syscallTrace != "" {
+		execArgs = append(execArgs, "--syscall_trace", s.syscallTrace)
+	}
+
+	if s.lockMemory {
+		execArgs = append(execArgs, "--lock_memory")
+	}
+
+	if s.limitExit != 0 {
+		execArgs = append(execArgs, "--limit_exit_code", strconv.Itoa(s.limitExit))
+	}
+
+	if s.schedPolicy != "" {
+		execArgs = append(execArgs, "--sched_policy", string(s.schedPolicy),
+			"--sched_priority", strconv.Itoa(s.schedPriority))
+	}
+
 	if s.saveUsageStat != "" {
 		execArgs = append(execArgs, "--save_usage_stat", s.saveUsageStat)
 	}
 
+	if s.statInterval != 0 {
+		execArgs = append(execArgs, "--usage_stat_interval", strconv.FormatInt(s.statInterval.Milliseconds(), 10))
+	}
+
+	if s.setupLimit != 0 {
+		execArgs = append(execArgs, "--setup_time_limit", strconv.FormatInt(s.setupLimit.Milliseconds(), 10))
+	}
+
+	if s.wallLimit != 0 {
+		execArgs = append(execArgs, "--wall_time_limit", strconv.FormatInt(s.wallLimit.Milliseconds(), 10))
+	}
+
+	if s.limitSignal != 0 {
+		execArgs = append(execArgs, "--time_limit_signal", strconv.Itoa(int(s.limitSignal)))
+	}
+
+	if s.timeOffset != 0 {
+		execArgs = append(execArgs, "--time_offset", strconv.FormatInt(s.timeOffset.Milliseconds(), 10))
+	}
+
 	if s.execDir != "" {
 		execArgs = append(execArgs, "--exec_dir", s.execDir)
 	}
 
-	execArgs = append(execArgs, "--", path)
-	execArgs = append(execArgs, args...)
+	if s.tmpDir != "" {
+		execArgs = append(execArgs, "--tmp_dir", s.tmpDir)
+	}
+
+	if s.chrootDir != "" {
+		execArgs = append(execArgs, "--chroot_dir", s.chrootDir)
+	}
+
+	if s.readOnlyRoot {
+		execArgs = append(execArgs, "--read_only_root")
+	}
+
+	for _, w := range s.writable {
+		execArgs = append(execArgs, "--writable", w)
+	}
+
+	for _, l := range s.labels {
+		execArgs = append(execArgs, "--label", l[0]+"="+l[1])
+	}
+
+	for _, kv := range s.sysctls {
+		execArgs = append(execArgs, "--sysctl", kv[0]+"="+kv[1])
+	}
+
+	if s.killChildren != nil {
+		if *s.killChildren {
+			execArgs = append(execArgs, "--kill_children_on_exit")
+		} else {
+			execArgs = append(execArgs, "--no_kill_children_on_exit")
+		}
+	}
+
+	if s.verbosity != 0 {
+		execArgs = append(execArgs, "--verbosity", strconv.Itoa(s.verbosity))
+	}
+
+	return execArgs
+}
+
+// mappingArgs appends the flags for files and dirs to execArgs, merged in insertion order.
+func (s *Sandbox) mappingArgs(execArgs []string, files []file, dirs []mountDir) []string {
+	for len(files) != 0 || len(dirs) != 0 {
+		if len(dirs) == 0 || (len(files) != 0 && files[0].seq < dirs[0].seq) {
+			f := files[0]
+			files = files[1:]
+
+			if f.skipped() {
+				warnf("skipping optional file %s: source does not exist", f.src)
+				continue
+			}
+
+			if f.withLibs {
+				execArgs = append(execArgs, "--add_elf_file")
+			} else {
+				execArgs = append(execArgs, "--add_file")
+			}
+
+			execArgs = append(execArgs, f.src, f.dst)
+			continue
+		}
+
+		d := dirs[0]
+		dirs = dirs[1:]
+
+		if d.quota != 0 && !d.readOnly {
+			execArgs = append(execArgs, "--mount_dir_quota", d.src, d.dst, strconv.FormatUint(d.quota, 10))
+			continue
+		}
+
+		if d.readOnly {
+			execArgs = append(execArgs, "--mount_dir_ro")
+		} else {
+			execArgs = append(execArgs, "--mount_dir")
+		}
+
+		execArgs = append(execArgs, d.src, d.dst)
+	}
+
 	return execArgs
 }
+
+// uidFlags are the flags for the real, effective and saved user IDs set by SetUIDs.
+var uidFlags = [3]string{"--ruid", "--euid", "--suid"}
+
+func (s *Sandbox) separatorToken() string {
+	if s.separator == "" {
+		return "--"
+	}
+
+	return s.separator
+}
+
+// wrapSetup returns a shell command that runs the setup command and then executes path with args.
+func (s *Sandbox) wrapSetup(path string, args []string) (string, []string) {
+	quoted := make([]string, len(s.setupCmd))
+	for i, a := range s.setupCmd {
+		quoted[i] = shellQuote(a)
+	}
+
+	script := strings.Join(quoted, " ") + ` && exec "$0" "$@"`
+	return "/bin/sh", append([]string{"-c", script, path}, args...)
+}
+
+// key returns the name of the variable.
+func (e envVar) key() string {
+	return strings.SplitN(e.value, "=", 2)[0]
+}
+
+// render returns the KEY=VALUE form of the variable, with the value masked if redact is set and
+// the variable is secret.
+func (e envVar) render(redact bool) string {
+	if !redact || !e.secret {
+		return e.value
+	}
+
+	return e.key() + "=***"
+}
+
+// shellQuote quotes s for a POSIX shell if it contains anything but safe characters.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+=/.,:@%") == "" {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
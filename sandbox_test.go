@@ -2,8 +2,11 @@ package sandbox_test
 
 import (
 	"context"
+	"errors"
 	"log"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
@@ -55,3 +58,506 @@ func TestSandbox(t *testing.T) {
 		t.Fatalf("command output: %s", string(out))
 	}
 }
+
+// hasArgs reports whether want appears in args as a contiguous sequence.
+func hasArgs(args []string, want ...string) bool {
+	for i := 0; i+len(want) <= len(args); i++ {
+		match := true
+		for j, w := range want {
+			if args[i+j] != w {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestSetChrootDir(t *testing.T) {
+	args := sandbox.New("/srv/images/base").SetChrootDir("rootfs").BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--chroot_dir", "rootfs") {
+		t.Fatalf("missing --chroot_dir: %q", args)
+	}
+
+	args = sandbox.New("/srv/images/base").BuildExecArgs("/bin/true", nil)
+	if hasArgs(args, "--chroot_dir") {
+		t.Fatalf("unexpected --chroot_dir: %q", args)
+	}
+}
+
+func TestSetCpuMax(t *testing.T) {
+	args := sandbox.New("/root").SetCpuMax(50000, 100000).BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--cpu_max", "50000", "100000") {
+		t.Fatalf("missing --cpu_max: %q", args)
+	}
+
+	args = sandbox.New("/root").SetCpuMax(50000, 0).BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--cpu_max", "50000", "100000") {
+		t.Fatalf("zero period not defaulted: %q", args)
+	}
+
+	sbox, _, _, err := sandbox.ParseArgs([]string{"/root", "--cpu_max", "50000", "0", "--", "/bin/true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sbox.Validate(); err == nil {
+		t.Fatal("expected error for a zero period")
+	}
+}
+
+func TestAddSecretEnv(t *testing.T) {
+	sbox := sandbox.New("/root").AddEnvKV("USER", "judge").AddSecretEnv("TOKEN", "s3cr3t")
+
+	args := sbox.BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--env", "USER=judge", "--env", "TOKEN=s3cr3t") {
+		t.Fatalf("env not passed as is: %q", args)
+	}
+
+	line := sbox.CommandLine("/bin/echo", "hello world")
+	want := sandbox.Path + " /root --env USER=judge --env 'TOKEN=***' -- /bin/echo 'hello world'"
+	if line != want {
+		t.Fatalf("command line:\n got: %s\nwant: %s", line, want)
+	}
+}
+
+func TestSetOOMScoreAdj(t *testing.T) {
+	args := sandbox.New("/root").SetOOMScoreAdj(0).BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--oom_score_adj", "0") {
+		t.Fatalf("missing --oom_score_adj: %q", args)
+	}
+
+	args = sandbox.New("/root").BuildExecArgs("/bin/true", nil)
+	if hasArgs(args, "--oom_score_adj") {
+		t.Fatalf("unexpected --oom_score_adj: %q", args)
+	}
+}
+
+func TestSetToolEnv(t *testing.T) {
+	sbox := sandbox.New("/root")
+	if cmd := sbox.Command("/bin/true"); cmd.Env != nil {
+		t.Fatalf("expected inherited environment, got %q", cmd.Env)
+	}
+
+	cmd := sbox.SetToolEnv([]string{"PATH=/usr/bin"}).Command("/bin/true")
+	if len(cmd.Env) != 1 || cmd.Env[0] != "PATH=/usr/bin" {
+		t.Fatalf("tool environment: %q", cmd.Env)
+	}
+
+	if hasArgs(cmd.Args, "--env") {
+		t.Fatalf("tool environment leaked into sandbox env: %q", cmd.Args)
+	}
+}
+
+func TestSetMemHighMax(t *testing.T) {
+	args := sandbox.New("/root").SetMemHigh(512).BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--mem_high", "512") || hasArgs(args, "--mem_limit") {
+		t.Fatalf("unexpected memory flags: %q", args)
+	}
+
+	args = sandbox.New("/root").SetMemMax(1024).BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--mem_limit", "1024") || hasArgs(args, "--mem_high") {
+		t.Fatalf("unexpected memory flags: %q", args)
+	}
+}
+
+func TestSetNamespaces(t *testing.T) {
+	args := sandbox.New("/root").
+		SetNamespaces(sandbox.NamespacePID|sandbox.NamespaceMount|sandbox.NamespaceNet).
+		BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--no_new_net") || !hasArgs(args, "--unshare", "pid,mount") {
+		t.Fatalf("unexpected namespace flags: %q", args)
+	}
+
+	args = sandbox.New("/root").SetNoNewNet(true).BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--no_new_net") || hasArgs(args, "--unshare") {
+		t.Fatalf("unexpected namespace flags: %q", args)
+	}
+
+	args = sandbox.New("/root").SetNoNewNet(true).SetNamespaces(sandbox.NamespacePID).BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--no_new_net") || !hasArgs(args, "--unshare", "pid") {
+		t.Fatalf("network isolation lost: %q", args)
+	}
+}
+
+func TestCommandFD(t *testing.T) {
+	f, err := os.Open("/bin/true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cmd := sandbox.New("/root").CommandFD(nil, f, "a")
+	if !hasArgs(cmd.Args, "--exec_fd", "3", "--", "/dev/fd/3", "a") {
+		t.Fatalf("unexpected args: %q", cmd.Args)
+	}
+
+	if len(cmd.ExtraFiles) != 1 || cmd.ExtraFiles[0] != f {
+		t.Fatalf("program fd is not passed: %v", cmd.ExtraFiles)
+	}
+}
+
+func TestSetKillChildrenOnExit(t *testing.T) {
+	sbox := sandbox.New("/root")
+	if args := sbox.BuildExecArgs("/bin/true", nil); hasArgs(args, "--kill_children_on_exit") || hasArgs(args, "--no_kill_children_on_exit") {
+		t.Fatalf("unexpected flag with tool default: %q", args)
+	}
+
+	if args := sbox.SetKillChildrenOnExit(true).BuildExecArgs("/bin/true", nil); !hasArgs(args, "--kill_children_on_exit") {
+		t.Fatalf("missing --kill_children_on_exit: %q", args)
+	}
+
+	if args := sbox.SetKillChildrenOnExit(false).BuildExecArgs("/bin/true", nil); !hasArgs(args, "--no_kill_children_on_exit") {
+		t.Fatalf("missing --no_kill_children_on_exit: %q", args)
+	}
+}
+
+func TestSchedulingFlagsPrecedeCommand(t *testing.T) {
+	args := sandbox.New("/root").SetCpuSet("4-7").SetNice(10).BuildExecArgs("/bin/prog", []string{"--nice", "0"})
+
+	sep := -1
+	for i, a := range args {
+		if a == "--" {
+			sep = i
+			break
+		}
+	}
+
+	if sep < 0 || !hasArgs(args[:sep], "--cpuset", "4-7") || !hasArgs(args[:sep], "--nice", "10") {
+		t.Fatalf("scheduling flags must precede the separator: %q", args)
+	}
+}
+
+func TestMountDirs(t *testing.T) {
+	dirs := []sandbox.DirMapping{
+		{Src: "/srv/data", Dst: "/data", ReadOnly: true},
+		{Src: "/srv/out", Dst: "/out"},
+	}
+
+	sbox := sandbox.New("/root").MountDir("/work", "/work").MountDirs(dirs...)
+
+	args := sbox.BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--mount_dir", "/work", "/work", "--mount_dir_ro", "/srv/data", "/data", "--mount_dir", "/srv/out", "/out") {
+		t.Fatalf("unexpected mounts: %q", args)
+	}
+
+	copied := sandbox.New("/root").MountDirs(sbox.Mounts()...)
+	if !reflect.DeepEqual(copied.Mounts(), sbox.Mounts()) {
+		t.Fatalf("mounts do not round trip: %v", copied.Mounts())
+	}
+}
+
+func TestSetSetupCommand(t *testing.T) {
+	sbox := sandbox.New("/root").SetSetupCommand("/bin/chmod", "+x", "/work/my prog")
+
+	args := sbox.BuildExecArgs("/work/my prog", []string{"a b"})
+	want := []string{"--", "/bin/sh", "-c", `/bin/chmod +x '/work/my prog' && exec "$0" "$@"`, "/work/my prog", "a b"}
+	if !hasArgs(args, want...) {
+		t.Fatalf("unexpected command:\n got: %q\nwant: %q", args, want)
+	}
+
+	args = sbox.SetSetupCommand("").BuildExecArgs("/bin/prog", nil)
+	if !hasArgs(args, "--", "/bin/prog") {
+		t.Fatalf("setup command was not removed: %q", args)
+	}
+}
+
+func TestSetSeparatorToken(t *testing.T) {
+	sbox := sandbox.New("/root").SetSeparatorToken("exec")
+
+	args := sbox.BuildExecArgs("/bin/prog", []string{"--"})
+	if !hasArgs(args, "exec", "/bin/prog", "--") || hasArgs(args, "--", "/bin/prog") {
+		t.Fatalf("unexpected separator: %q", args)
+	}
+
+	args = sbox.SetSeparatorToken("").BuildExecArgs("/bin/prog", nil)
+	if !hasArgs(args, "--", "/bin/prog") {
+		t.Fatalf("default separator was not restored: %q", args)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	sbox := sandbox.New("/root").
+		AddFile("/bin/sh", "/bin/sh", true).
+		AddFile("/bin/sh", "/bin/sh", false).
+		AddFile("/bin/sh", "/bin/sh", true).
+		MountDir("/data", "/data").
+		MountDirReadOnly("/data", "/data").
+		MountDir("/data", "/data").
+		Dedup()
+
+	want := []string{"/root",
+		"--add_elf_file", "/bin/sh", "/bin/sh",
+		"--add_file", "/bin/sh", "/bin/sh",
+		"--mount_dir", "/data", "/data",
+		"--mount_dir_ro", "/data", "/data",
+		"--", "/bin/true"}
+	if got := sbox.BuildExecArgs("/bin/true", nil); !reflect.DeepEqual(got, want) {
+		t.Fatalf("dedup:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestEnableDNS(t *testing.T) {
+	args := sandbox.New("/root").EnableDNS().BuildExecArgs("/bin/true", nil)
+	for _, f := range []string{"/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf"} {
+		if !hasArgs(args, "--add_file", f, f) {
+			t.Fatalf("missing %s: %q", f, args)
+		}
+	}
+
+	var warnings []string
+	prev := sandbox.Warnf
+	sandbox.Warnf = func(format string, args ...interface{}) { warnings = append(warnings, format) }
+	defer func() { sandbox.Warnf = prev }()
+
+	cmd := sandbox.New("/root").EnableDNS().SetNoNewNet(true).Command("/bin/true")
+	if hasArgs(cmd.Args, "/etc/resolv.conf") || len(warnings) != 1 {
+		t.Fatalf("EnableDNS with isolated network: args %q, warnings %q", cmd.Args, warnings)
+	}
+}
+
+func TestSetNewProcessGroup(t *testing.T) {
+	if cmd := sandbox.New("/root").Command("/bin/true"); cmd.SysProcAttr != nil {
+		t.Fatalf("unexpected SysProcAttr: %+v", cmd.SysProcAttr)
+	}
+
+	cmd := sandbox.New("/root").SetNewProcessGroup(true).Command("/bin/true")
+	if cmd.SysProcAttr == nil || !cmd.SysProcAttr.Setpgid || cmd.SysProcAttr.Foreground {
+		t.Fatalf("unexpected SysProcAttr: %+v", cmd.SysProcAttr)
+	}
+}
+
+func TestMountDirMulti(t *testing.T) {
+	args := sandbox.New("/root").MountDirMultiReadOnly("/srv/data", "/opt/data", "/data").BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--mount_dir_ro", "/srv/data", "/opt/data", "--mount_dir_ro", "/srv/data", "/data") {
+		t.Fatalf("unexpected mounts: %q", args)
+	}
+}
+
+func TestDestinations(t *testing.T) {
+	dsts := sandbox.New("/root").
+		MountDir("/data", "/data").
+		AddFile("/bin/sh", "/bin/sh", true).
+		AddFile("/srv/hosts", "/etc/hosts", false).
+		EnableDNS().
+		Destinations()
+
+	want := []string{"/bin/sh", "/data", "/etc/hosts", "/etc/hosts", "/etc/nsswitch.conf", "/etc/resolv.conf"}
+	if !reflect.DeepEqual(dsts, want) {
+		t.Fatalf("destinations:\n got: %q\nwant: %q", dsts, want)
+	}
+
+	sbox := sandbox.New("/root").SetTmpDir("/h")
+	if dsts := sbox.Destinations(); !reflect.DeepEqual(dsts, []string{"/tmp"}) {
+		t.Fatalf("tmp dir destination: %q", dsts)
+	}
+
+	sbox.MountDir("/data", "/tmp")
+	if dsts := sbox.Destinations(); !reflect.DeepEqual(dsts, []string{"/tmp", "/tmp"}) {
+		t.Fatalf("tmp dir collision not reported: %q", dsts)
+	}
+	if err := sbox.Validate(); !errors.Is(err, sandbox.ErrDuplicateDst) {
+		t.Fatalf("expected ErrDuplicateDst, got %v", err)
+	}
+}
+
+func TestAddFileOptional(t *testing.T) {
+	present := filepath.Join(t.TempDir(), "present.conf")
+	if err := os.WriteFile(present, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	absent := filepath.Join(t.TempDir(), "absent.conf")
+
+	var warnings []string
+	prev := sandbox.Warnf
+	sandbox.Warnf = func(format string, args ...interface{}) { warnings = append(warnings, format) }
+	defer func() { sandbox.Warnf = prev }()
+
+	sbox := sandbox.New("/root").
+		SetCheckSources(true).
+		AddFileOptional(present, "/etc/present.conf", false).
+		AddFileOptional(absent, "/etc/absent.conf", false)
+
+	if err := sbox.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	args := sbox.BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--add_file", present, "/etc/present.conf") || hasArgs(args, absent) {
+		t.Fatalf("unexpected files: %q", args)
+	}
+
+	if len(warnings) != 1 {
+		t.Fatalf("warnings: %q", warnings)
+	}
+}
+
+func TestCommandSlice(t *testing.T) {
+	cmd, err := sandbox.New("/root").CommandSlice(context.Background(), []string{"/bin/echo", "a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !hasArgs(cmd.Args, "--", "/bin/echo", "a", "b") {
+		t.Fatalf("unexpected args: %q", cmd.Args)
+	}
+
+	if _, err := sandbox.New("/root").CommandSlice(context.Background(), nil); err == nil {
+		t.Fatal("expected error for empty argv")
+	}
+}
+
+func TestSetLimits(t *testing.T) {
+	args := sandbox.New("/root").SetLimits(sandbox.Limits{
+		Memory:    64 << 20,
+		CpuTime:   1500 * time.Millisecond,
+		WallTime:  3 * time.Second,
+		Pids:      8,
+		OpenFiles: 16,
+	}).BuildExecArgs("/bin/true", nil)
+
+	want := []string{"/root",
+		"--mem_limit", "67108864",
+		"--pids_max", "8",
+		"--rlimit", "cpu=2",
+		"--rlimit", "nofile=16",
+		"--wall_time_limit", "3000",
+		"--", "/bin/true"}
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("limits:\n got: %q\nwant: %q", args, want)
+	}
+
+	if args := sandbox.New("/root").SetLimits(sandbox.Limits{}).BuildExecArgs("/bin/true", nil); len(args) != 3 {
+		t.Fatalf("unexpected flags for zero limits: %q", args)
+	}
+}
+
+func TestSetCoreDumpPath(t *testing.T) {
+	args := sandbox.New("/root").SetCoreDumpPath("/var/crash").BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--rlimit", "core=18446744073709551615") || !hasArgs(args, "--core_dump_path", "/var/crash") {
+		t.Fatalf("missing core dump flags: %q", args)
+	}
+
+	if args := sandbox.New("/root").SetCoreDumpPath("").BuildExecArgs("/bin/true", nil); len(args) != 3 {
+		t.Fatalf("unexpected flags: %q", args)
+	}
+}
+
+func TestCommandArgv0(t *testing.T) {
+	cmd := sandbox.New("/root").CommandArgv0(context.Background(), "/bin/busybox", "ls", "-l")
+	if !hasArgs(cmd.Args, "--argv0", "ls", "--", "/bin/busybox", "-l") {
+		t.Fatalf("unexpected args: %q", cmd.Args)
+	}
+}
+
+func TestSetLockMemory(t *testing.T) {
+	args := sandbox.New("/root").SetLockMemory(true).BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--rlimit", "memlock=18446744073709551615") || !hasArgs(args, "--lock_memory") {
+		t.Fatalf("missing memory locking flags: %q", args)
+	}
+
+	if args := sandbox.New("/root").SetLockMemory(false).BuildExecArgs("/bin/true", nil); len(args) != 3 {
+		t.Fatalf("unexpected flags: %q", args)
+	}
+}
+
+func TestSetUIDs(t *testing.T) {
+	argv := sandbox.New("/root").SetUIDs(1000, 0, -1).BuildExecArgs("/bin/true", nil)
+	if !hasArgs(argv, "--ruid", "1000", "--euid", "0") {
+		t.Fatalf("missing uid flags in %q", argv)
+	}
+	for _, arg := range argv {
+		if arg == "--suid" {
+			t.Fatalf("unexpected --suid in %q", argv)
+		}
+	}
+}
+
+func TestSetPreserveInsertionOrder(t *testing.T) {
+	build := func(preserve bool) []string {
+		return sandbox.New("/root").
+			SetPreserveInsertionOrder(preserve).
+			MountDir("/srv/a", "/a").
+			AddFile("/srv/b", "/a/b", false).
+			MountDirReadOnly("/srv/c", "/a/c").
+			BuildExecArgs("/bin/true", nil)
+	}
+
+	want := []string{"/root", "--mount_dir", "/srv/a", "/a", "--add_file", "/srv/b", "/a/b", "--mount_dir_ro", "/srv/c", "/a/c"}
+	argv := build(true)
+	if !reflect.DeepEqual(argv[:len(want)], want) {
+		t.Fatalf("interleaved args:\n got: %q\nwant: %q", argv, want)
+	}
+
+	want = []string{"/root", "--add_file", "/srv/b", "/a/b", "--mount_dir", "/srv/a", "/a", "--mount_dir_ro", "/srv/c", "/a/c"}
+	if got := build(false); !reflect.DeepEqual(got[:len(want)], want) {
+		t.Fatalf("grouped args:\n got: %q\nwant: %q", got, want)
+	}
+
+	parsed, path, args, err := sandbox.ParseArgs(argv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.BuildExecArgs(path, args); !reflect.DeepEqual(got, argv) {
+		t.Fatalf("round trip mismatch:\n got: %q\nwant: %q", got, argv)
+	}
+}
+
+func TestSetNetNamespace(t *testing.T) {
+	sbox := sandbox.New("/root").SetNetNamespace("/run/netns/judge")
+	if err := sbox.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	argv := sbox.BuildExecArgs("/bin/true", nil)
+	if !hasArgs(argv, "--net_ns", "/run/netns/judge") {
+		t.Fatalf("missing --net_ns in %q", argv)
+	}
+
+	parsed, path, args, err := sandbox.ParseArgs(argv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.BuildExecArgs(path, args); !reflect.DeepEqual(got, argv) {
+		t.Fatalf("round trip mismatch:\n got: %q\nwant: %q", got, argv)
+	}
+
+	var cfgErr *sandbox.ConfigError
+	if err := sbox.SetNoNewNet(true).Validate(); !errors.As(err, &cfgErr) || cfgErr.Field != "net_ns" {
+		t.Fatalf("expected net_ns error, got %v", err)
+	}
+}
+
+func TestSetCapabilitySet(t *testing.T) {
+	argv := sandbox.New("/root").SetCapabilitySet("CAP_NET_RAW", "Kill").BuildExecArgs("/bin/true", nil)
+	if !hasArgs(argv, "--cap_bounding_set", "net_raw,kill") {
+		t.Fatalf("missing --cap_bounding_set in %q", argv)
+	}
+
+	sbox := sandbox.New("/root").SetCapabilitySet()
+	if err := sbox.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	argv = sbox.BuildExecArgs("/bin/true", nil)
+	if !hasArgs(argv, "--cap_bounding_set", "") {
+		t.Fatalf("missing empty --cap_bounding_set in %q", argv)
+	}
+
+	parsed, path, args, err := sandbox.ParseArgs(argv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.Clone().BuildExecArgs(path, args); !reflect.DeepEqual(got, argv) {
+		t.Fatalf("round trip mismatch:\n got: %q\nwant: %q", got, argv)
+	}
+
+	var cfgErr *sandbox.ConfigError
+	if err := sbox.SetCapabilitySet("kill", "cap_fly").Validate(); !errors.As(err, &cfgErr) || cfgErr.Field != "cap_bounding_set" || cfgErr.Index != 1 {
+		t.Fatalf("expected cap_bounding_set error, got %v", err)
+	}
+}
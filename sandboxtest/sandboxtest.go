@@ -0,0 +1,62 @@
+// Package sandboxtest provides helpers for testing code that runs programs through package sandbox
+// without the real sandbox tool.
+package sandboxtest
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+// Recorder records the sandbox tool invocations made while it is installed.
+//
+// Instead of the sandbox tool, every recorded command runs "true" from PATH, so it succeeds
+// without output.
+type Recorder struct {
+	mu    sync.Mutex
+	calls [][]string
+}
+
+// New installs a Recorder as the sandbox runner until the test finishes.
+func New(tb testing.TB) *Recorder {
+	r := &Recorder{}
+
+	sandbox.SetRunner(r.command)
+	tb.Cleanup(func() { sandbox.SetRunner(nil) })
+
+	return r
+}
+
+func (r *Recorder) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	r.mu.Lock()
+	r.calls = append(r.calls, append([]string{name}, args...))
+	r.mu.Unlock()
+
+	return exec.CommandContext(ctx, "true")
+}
+
+// Calls returns the argv of every recorded invocation, including the sandbox executable, in order.
+func (r *Recorder) Calls() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	calls := make([][]string, len(r.calls))
+	copy(calls, r.calls)
+
+	return calls
+}
+
+// Last returns the argv of the most recent invocation, or nil if there was none.
+func (r *Recorder) Last() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.calls) == 0 {
+		return nil
+	}
+
+	return r.calls[len(r.calls)-1]
+}
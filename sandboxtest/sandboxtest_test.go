@@ -0,0 +1,28 @@
+package sandboxtest_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+	"github.com/Highload-fun/libsandbox/sandboxtest"
+)
+
+func TestRecorder(t *testing.T) {
+	rec := sandboxtest.New(t)
+
+	sbox := sandbox.New("/root").SetMemLimit(1024)
+	if _, err := sbox.Run(context.Background(), "/bin/prog", "arg"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := append([]string{sandbox.Path}, sbox.BuildExecArgs("/bin/prog", []string{"arg"})...)
+	if got := rec.Last(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("recorded argv:\n got: %q\nwant: %q", got, want)
+	}
+
+	if len(rec.Calls()) != 1 {
+		t.Fatalf("calls: %q", rec.Calls())
+	}
+}
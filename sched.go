@@ -0,0 +1,31 @@
+package sandbox
+
+// SchedPolicy is a real-time scheduling policy for the sandboxed process.
+type SchedPolicy string
+
+const (
+	// SchedFIFO is the SCHED_FIFO policy: first in, first out without time slicing.
+	SchedFIFO SchedPolicy = "fifo"
+	// SchedRR is the SCHED_RR policy: round robin with time slicing.
+	SchedRR SchedPolicy = "rr"
+)
+
+// SetSchedPolicy runs the sandboxed process under a real-time scheduling policy with the given
+// priority, which must be within [1, 99].
+//
+// WARNING: a real-time process that never blocks starves every normal process on its CPUs,
+// including the host's own services. Always combine it with SetCpuSet and a CPU time limit. To
+// make the risk explicit, Validate rejects the configuration unless SetAllowRealtime(true) is set.
+func (s *Sandbox) SetSchedPolicy(policy SchedPolicy, priority int) *Sandbox {
+	s.schedPolicy = policy
+	s.schedPriority = priority
+
+	return s
+}
+
+// SetAllowRealtime acknowledges the risks of real-time scheduling configured with SetSchedPolicy.
+func (s *Sandbox) SetAllowRealtime(v bool) *Sandbox {
+	s.allowRealtime = v
+
+	return s
+}
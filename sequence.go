@@ -0,0 +1,99 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// RunSequence runs several commands one after another in a single sandbox instance, so that the
+// setup cost of the sandbox is paid once. Each command is given as its argv, path first.
+//
+// The sandbox tool executes a single program, so the commands are run by a /bin/sh wrapper, which
+// must exist inside the sandbox. Every command runs to completion, even if an earlier one failed,
+// and they share the sandbox filesystem, working directory, standard input and resource limits:
+// time and memory limits apply to the whole sequence, not to each command.
+//
+// The returned slice has one Result per command, holding its own output and exit code, and is
+// returned even when err is not nil. A command that did not finish, because the sequence was
+// killed, has ExitCode -1 and gets all remaining output. Usage statistics describe the whole
+// sequence and are only set on the last Result.
+func (s *Sandbox) RunSequence(ctx context.Context, cmds [][]string) ([]*Result, error) {
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+
+	for i, argv := range cmds {
+		if len(argv) == 0 {
+			return nil, fmt.Errorf("sandbox: command %d is empty", i)
+		}
+	}
+
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	marker := "sandbox-seq-" + hex.EncodeToString(b[:])
+
+	var script strings.Builder
+	for i, argv := range cmds {
+		quoted := make([]string, len(argv))
+		for j, a := range argv {
+			quoted[j] = shellQuote(a)
+		}
+
+		fmt.Fprintf(&script, "%s; c=$?; printf '%s %d %%d\\n' \"$c\"; printf '%s %d\\n' >&2\n",
+			strings.Join(quoted, " "), marker, i, marker, i)
+	}
+	script.WriteString("exit 0\n")
+
+	res, err := s.Run(ctx, "/bin/sh", "-c", script.String())
+
+	results := make([]*Result, len(cmds))
+	stdout, stderr := res.Stdout, res.Stderr
+	for i := range results {
+		r := &Result{ExitCode: -1, MemLimit: res.MemLimit, CpuTimeLimit: res.CpuTimeLimit, WallTimeLimit: res.WallTimeLimit}
+		results[i] = r
+
+		r.Stdout, stdout = splitMarker(stdout, marker)
+		r.Stderr, stderr = splitMarker(stderr, marker)
+
+		if stdout != nil {
+			var n, code int
+			if _, scanErr := fmt.Sscanf(string(stdout), " %d %d", &n, &code); scanErr == nil && n == i {
+				r.ExitCode = code
+			}
+			stdout = skipLine(stdout)
+		}
+		stderr = skipLine(stderr)
+	}
+
+	last := results[len(results)-1]
+	last.Signal, last.TimedOut, last.OutputTruncated = res.Signal, res.TimedOut, res.OutputTruncated
+	last.Usage, last.ToolRusage = res.Usage, res.ToolRusage
+
+	return results, err
+}
+
+// splitMarker returns the data before the first marker and the data after it. If there is no
+// marker, all data is returned as the first value and the rest is nil.
+func splitMarker(data []byte, marker string) (before, after []byte) {
+	i := bytes.Index(data, []byte(marker))
+	if i < 0 {
+		return data, nil
+	}
+
+	return data[:i], data[i+len(marker):]
+}
+
+// skipLine drops data up to and including the first newline.
+func skipLine(data []byte) []byte {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return data[i+1:]
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package sandbox_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestRunSequence(t *testing.T) {
+	// The fake tool runs the command after the separator directly on the host.
+	script := writeFile(t, "tool.sh", `#!/bin/sh
+while [ "$1" != "--" ]; do shift; done
+shift
+exec "$@"
+`)
+	if err := os.Chmod(script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	withToolPath(t, script)
+
+	results, err := sandbox.New("/root").RunSequence(context.Background(), [][]string{
+		{"/bin/echo", "it's first"},
+		{"/bin/sh", "-c", "printf partial; echo oops >&2; exit 3"},
+		{"/bin/echo", "third"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		stdout, stderr string
+		code           int
+	}{
+		{"it's first\n", "", 0},
+		{"partial", "oops\n", 3},
+		{"third\n", "", 0},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results", len(results))
+	}
+	for i, w := range want {
+		r := results[i]
+		if string(r.Stdout) != w.stdout || string(r.Stderr) != w.stderr || r.ExitCode != w.code {
+			t.Errorf("result %d: stdout %q, stderr %q, exit code %d", i, r.Stdout, r.Stderr, r.ExitCode)
+		}
+	}
+
+	if _, err := sandbox.New("/root").RunSequence(context.Background(), [][]string{{}}); err == nil {
+		t.Fatal("expected error for empty command")
+	}
+}
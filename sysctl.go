@@ -0,0 +1,49 @@
+package sandbox
+
+import "strings"
+
+// ipcSysctls lists the IPC namespace sysctls accepted by SetSysctl, besides fs.mqueue.*.
+var ipcSysctls = map[string]bool{
+	"kernel.msgmax": true, "kernel.msgmnb": true, "kernel.msgmni": true, "kernel.sem": true,
+	"kernel.shmall": true, "kernel.shmmax": true, "kernel.shmmni": true, "kernel.shm_rmid_forced": true,
+}
+
+// SetSysctl sets a kernel parameter, such as "net.ipv4.ip_forward", inside the namespaces of the
+// sandbox. Setting the same key again replaces its value.
+//
+// Only sysctls that belong to a namespace of the sandbox can be set, so that they never affect
+// the host; Validate rejects the others:
+//   - net.* requires the network namespace, see SetNoNewNet;
+//   - kernel.msgmax, kernel.msgmnb, kernel.msgmni, kernel.sem, kernel.shmall, kernel.shmmax,
+//     kernel.shmmni, kernel.shm_rmid_forced and fs.mqueue.* require NamespaceIPC.
+func (s *Sandbox) SetSysctl(key, value string) *Sandbox {
+	for i := range s.sysctls {
+		if s.sysctls[i][0] == key {
+			s.sysctls[i][1] = value
+			return s
+		}
+	}
+
+	s.sysctls = append(s.sysctls, [2]string{key, value})
+
+	return s
+}
+
+func (s *Sandbox) validateSysctls() error {
+	for i, kv := range s.sysctls {
+		switch key := kv[0]; {
+		case strings.HasPrefix(key, "net."):
+			if !s.noNewNet {
+				return configErr("sysctl", i, ErrPolicy, "%s requires a network namespace, see SetNoNewNet", key)
+			}
+		case ipcSysctls[key] || strings.HasPrefix(key, "fs.mqueue."):
+			if s.namespaces&NamespaceIPC == 0 {
+				return configErr("sysctl", i, ErrPolicy, "%s requires NamespaceIPC", key)
+			}
+		default:
+			return configErr("sysctl", i, ErrPolicy, "%s is not a namespaced sysctl", key)
+		}
+	}
+
+	return nil
+}
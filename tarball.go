@@ -0,0 +1,146 @@
+package sandbox
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NewFromTarball extracts a root filesystem image into a temporary directory and creates a sandbox
+// configuration rooted at it.
+//
+// Both plain and gzip-compressed tarballs are accepted; compression is detected by magic bytes.
+// The returned cleanup function removes the extracted root and must be called once the sandbox is
+// no longer used.
+func NewFromTarball(tarPath string) (*Sandbox, func(), error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	root, err := os.MkdirTemp("", "sandbox-root-")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cleanup := func() { os.RemoveAll(root) }
+
+	if err := extractTarball(f, root); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("extract %s: %w", tarPath, err)
+	}
+
+	return New(root), cleanup, nil
+}
+
+func extractTarball(r io.Reader, dir string) error {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	var src io.Reader = br
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+
+		src = zr
+	}
+
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := tarTarget(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := os.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0o700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+
+			if err := writeTarFile(target, mode, tr); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			if filepath.IsAbs(hdr.Linkname) {
+				return fmt.Errorf("hard link %q has absolute target %q", hdr.Name, hdr.Linkname)
+			}
+
+			linkTarget, err := tarTarget(dir, hdr.Linkname)
+			if err != nil {
+				return err
+			}
+
+			if err := os.Link(linkTarget, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// tarTarget resolves an archive entry name inside dir, rejecting names that escape it, either
+// textually or through a symbolic link extracted earlier. Extracted links point into the sandbox,
+// not the host, so they must never be followed while extracting.
+func tarTarget(dir, name string) (string, error) {
+	target := filepath.Join(dir, name)
+	if target != dir && !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("entry %q escapes the root", name)
+	}
+
+	for p := target; p != dir; p = filepath.Dir(p) {
+		if fi, err := os.Lstat(p); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("entry %q goes through symbolic link %q", name, strings.TrimPrefix(p, dir))
+		}
+	}
+
+	return target, nil
+}
+
+func writeTarFile(path string, mode os.FileMode, r io.Reader) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,123 @@
+package sandbox_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func writeTarball(t *testing.T, compress bool, entries map[string]string) string {
+	f, err := os.CreateTemp(t.TempDir(), "root-*.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var w io.Writer = f
+	if compress {
+		zw := gzip.NewWriter(f)
+		defer zw.Close()
+		w = zw
+	}
+
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+
+	for name, body := range entries {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(body)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return f.Name()
+}
+
+func TestNewFromTarball(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		tarPath := writeTarball(t, compress, map[string]string{"etc/hostname": "sandbox\n"})
+
+		sbox, cleanup, err := sandbox.NewFromTarball(tarPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		root := sbox.BuildExecArgs("/bin/true", nil)[0]
+
+		data, err := os.ReadFile(filepath.Join(root, "etc/hostname"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != "sandbox\n" {
+			t.Fatalf("extracted content: %q", data)
+		}
+
+		cleanup()
+
+		if _, err := os.Stat(root); !os.IsNotExist(err) {
+			t.Fatalf("root was not removed: %v", err)
+		}
+	}
+}
+
+func TestNewFromTarballEscape(t *testing.T) {
+	tarPath := writeTarball(t, false, map[string]string{"../escape": "x"})
+
+	if _, _, err := sandbox.NewFromTarball(tarPath); err == nil {
+		t.Fatal("expected error for entry escaping the root")
+	}
+}
+
+func TestNewFromTarballSymlinkEscape(t *testing.T) {
+	host := t.TempDir()
+
+	for _, entries := range [][]*tar.Header{
+		{
+			{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: host},
+			{Name: "evil/owned", Typeflag: tar.TypeReg, Mode: 0o644},
+		},
+		{
+			{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: host + "/owned"},
+			{Name: "evil", Typeflag: tar.TypeReg, Mode: 0o644},
+		},
+		{
+			{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "/etc/passwd"},
+		},
+		{
+			{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "../../etc/passwd"},
+		},
+	} {
+		f, err := os.CreateTemp(t.TempDir(), "root-*.tar")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tw := tar.NewWriter(f)
+		for _, hdr := range entries {
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tw.Close()
+		f.Close()
+
+		if _, cleanup, err := sandbox.NewFromTarball(f.Name()); err == nil {
+			cleanup()
+			t.Fatalf("expected error for %s -> %s", entries[0].Name, entries[0].Linkname)
+		}
+
+		if _, err := os.Stat(filepath.Join(host, "owned")); !os.IsNotExist(err) {
+			t.Fatalf("file written outside the root: %v", err)
+		}
+	}
+}
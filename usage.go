@@ -0,0 +1,203 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// UsageStat holds the execution statistics written by the sandbox tool when SaveUsageStat is set.
+type UsageStat struct {
+	// ExitCode is the exit code of the sandboxed process.
+	ExitCode int `json:"exit_code"`
+	// Signal is the number of the signal that terminated the process, or zero.
+	Signal int `json:"signal"`
+	// CpuTime is the user and system CPU time consumed, in microseconds.
+	CpuTime uint64 `json:"cpu_time"`
+	// WallTime is the elapsed real time, in microseconds.
+	WallTime uint64 `json:"wall_time"`
+	// MaxMemory is the peak memory usage, in bytes.
+	MaxMemory uint64 `json:"max_memory"`
+}
+
+// LimitUtilization returns how close the run came to its configured limits, as the ratio of the
+// usage statistics to each limit: "memory" for MaxMemory against MemLimit, "cpu_time" for CpuTime
+// against CpuTimeLimit and "wall_time" for WallTime against WallTimeLimit. Ratios above 1 mean
+// the limit was exceeded. Limits that are not set are omitted, and the map is empty if the run
+// has no usage statistics, see SaveUsageStat.
+func (r *Result) LimitUtilization() map[string]float64 {
+	util := make(map[string]float64)
+	if r.Usage == nil {
+		return util
+	}
+
+	if r.MemLimit != 0 {
+		util["memory"] = float64(r.Usage.MaxMemory) / float64(r.MemLimit)
+	}
+
+	if r.CpuTimeLimit != 0 {
+		util["cpu_time"] = float64(r.Usage.CpuTime) * float64(time.Microsecond) / float64(r.CpuTimeLimit)
+	}
+
+	if r.WallTimeLimit != 0 {
+		util["wall_time"] = float64(r.Usage.WallTime) * float64(time.Microsecond) / float64(r.WallTimeLimit)
+	}
+
+	return util
+}
+
+// ReadUsageStat parses a usage statistics file written by the sandbox tool.
+func ReadUsageStat(filename string) (*UsageStat, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var stat UsageStat
+	if err := json.Unmarshal(data, &stat); err != nil {
+		return nil, err
+	}
+
+	return &stat, nil
+}
+
+// usageStatPollInterval is how often WatchUsageStat checks the statistics file for changes.
+const usageStatPollInterval = 100 * time.Millisecond
+
+// WatchUsageStat follows a usage statistics file that the sandbox tool rewrites periodically, see
+// SetUsageStatInterval, and sends every new snapshot to the returned channel.
+//
+// The file does not need to exist yet. Snapshots that cannot be parsed, for example because the
+// file is being rewritten, are skipped. The channel is closed when ctx is done.
+func WatchUsageStat(ctx context.Context, path string) (<-chan *UsageStat, error) {
+	if path == "" {
+		return nil, errors.New("sandbox: empty usage statistics path")
+	}
+
+	ch := make(chan *UsageStat)
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(usageStatPollInterval)
+		defer ticker.Stop()
+
+		var last []byte
+		for {
+			if data, err := os.ReadFile(path); err == nil && !bytes.Equal(data, last) {
+				var stat UsageStat
+				if json.Unmarshal(data, &stat) == nil {
+					last = data
+
+					select {
+					case ch <- &stat:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// Outcome classifies why a sandboxed run ended.
+type Outcome int
+
+const (
+	// OutcomeOK means the process exited normally with a zero exit code.
+	OutcomeOK Outcome = iota
+	// OutcomeTimeLimit means the process reached its CPU or wall time limit, or the run context
+	// deadline.
+	OutcomeTimeLimit
+	// OutcomeMemoryLimit means the process failed after reaching its memory limit.
+	OutcomeMemoryLimit
+	// OutcomeRuntimeError means the process exited with a non-zero code or was killed by a signal.
+	OutcomeRuntimeError
+	// OutcomeOutputLimit means the process exceeded its output file size limit.
+	OutcomeOutputLimit
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeOK:
+		return "OK"
+	case OutcomeTimeLimit:
+		return "TimeLimit"
+	case OutcomeMemoryLimit:
+		return "MemoryLimit"
+	case OutcomeRuntimeError:
+		return "RuntimeError"
+	case OutcomeOutputLimit:
+		return "OutputLimit"
+	}
+
+	return "Unknown"
+}
+
+// Classify determines the outcome of the run.
+//
+// Usage statistics are preferred over the sandbox tool exit status when they are available.
+// Checks are applied in this order: context deadline, truncated output, SIGXCPU (time limit),
+// SIGXFSZ (output limit), wall time reaching WallTimeLimit or CPU time reaching CpuTimeLimit, the
+// tool exiting with LimitExitCode (memory limit if peak memory reached MemLimit, time limit
+// otherwise), peak memory reaching MemLimit on a failed run, then any other failure.
+func (r *Result) Classify() Outcome {
+	if r.TimedOut {
+		return OutcomeTimeLimit
+	}
+
+	if r.OutputTruncated {
+		return OutcomeOutputLimit
+	}
+
+	exitCode, signal := r.ExitCode, r.Signal
+	if r.Usage != nil {
+		exitCode, signal = r.Usage.ExitCode, syscall.Signal(r.Usage.Signal)
+	}
+
+	switch signal {
+	case syscall.SIGXCPU:
+		return OutcomeTimeLimit
+	case syscall.SIGXFSZ:
+		return OutcomeOutputLimit
+	}
+
+	if r.Usage != nil {
+		wall := time.Duration(r.Usage.WallTime) * time.Microsecond
+		cpu := time.Duration(r.Usage.CpuTime) * time.Microsecond
+		if r.WallTimeLimit != 0 && wall >= r.WallTimeLimit || r.CpuTimeLimit != 0 && cpu >= r.CpuTimeLimit {
+			return OutcomeTimeLimit
+		}
+	}
+
+	memoryReached := r.MemLimit != 0 && r.Usage != nil && r.Usage.MaxMemory >= r.MemLimit
+
+	if r.LimitExitCode != 0 && r.ExitCode == r.LimitExitCode {
+		if memoryReached {
+			return OutcomeMemoryLimit
+		}
+		return OutcomeTimeLimit
+	}
+
+	if exitCode == 0 && signal == 0 {
+		return OutcomeOK
+	}
+
+	if memoryReached {
+		return OutcomeMemoryLimit
+	}
+
+	return OutcomeRuntimeError
+}
@@ -0,0 +1,112 @@
+package sandbox_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func readUsage(t *testing.T, name string) *sandbox.UsageStat {
+	usage, err := sandbox.ReadUsageStat("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return usage
+}
+
+func TestReadUsageStat(t *testing.T) {
+	usage := readUsage(t, "usage_ok.json")
+
+	want := sandbox.UsageStat{CpuTime: 120000, WallTime: 150000, MaxMemory: 10485760}
+	if *usage != want {
+		t.Fatalf("usage: %+v", usage)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	const memLimit = 100 * 1024 * 1024
+
+	for _, tc := range []struct {
+		name string
+		res  sandbox.Result
+		want sandbox.Outcome
+	}{
+		{"ok", sandbox.Result{Usage: readUsage(t, "usage_ok.json"), MemLimit: memLimit}, sandbox.OutcomeOK},
+		{"deadline", sandbox.Result{ExitCode: -1, Signal: 9, TimedOut: true}, sandbox.OutcomeTimeLimit},
+		{"xcpu", sandbox.Result{Usage: readUsage(t, "usage_xcpu.json")}, sandbox.OutcomeTimeLimit},
+		{"oom", sandbox.Result{Usage: readUsage(t, "usage_oom.json"), MemLimit: memLimit}, sandbox.OutcomeMemoryLimit},
+		{"killed", sandbox.Result{Usage: readUsage(t, "usage_oom.json")}, sandbox.OutcomeRuntimeError},
+		{"exit", sandbox.Result{Usage: readUsage(t, "usage_exit.json"), MemLimit: memLimit}, sandbox.OutcomeRuntimeError},
+		{"wall time", sandbox.Result{Usage: readUsage(t, "usage_wall.json"), WallTimeLimit: time.Second}, sandbox.OutcomeTimeLimit},
+		{"cpu time", sandbox.Result{Usage: readUsage(t, "usage_cpu.json"), CpuTimeLimit: time.Second}, sandbox.OutcomeTimeLimit},
+		{"under time limits", sandbox.Result{Usage: readUsage(t, "usage_ok.json"), WallTimeLimit: time.Second, CpuTimeLimit: time.Second}, sandbox.OutcomeOK},
+		{"limit exit code", sandbox.Result{ExitCode: 100, LimitExitCode: 100}, sandbox.OutcomeTimeLimit},
+		{"limit exit code oom", sandbox.Result{ExitCode: 100, LimitExitCode: 100, Usage: readUsage(t, "usage_oom.json"), MemLimit: memLimit}, sandbox.OutcomeMemoryLimit},
+		{"other exit code", sandbox.Result{ExitCode: 1, LimitExitCode: 100}, sandbox.OutcomeRuntimeError},
+		{"xfsz", sandbox.Result{Usage: readUsage(t, "usage_xfsz.json")}, sandbox.OutcomeOutputLimit},
+		{"no usage", sandbox.Result{ExitCode: 1}, sandbox.OutcomeRuntimeError},
+	} {
+		if got := tc.res.Classify(); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestWatchUsageStat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ch, err := sandbox.WatchUsageStat(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cpu := range []uint64{100, 200} {
+		if err := os.WriteFile(path, []byte(fmt.Sprintf(`{"cpu_time": %d}`, cpu)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case stat := <-ch:
+			if stat.CpuTime != cpu {
+				t.Fatalf("snapshot: %+v", stat)
+			}
+		case <-ctx.Done():
+			t.Fatal("no snapshot received")
+		}
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestLimitUtilization(t *testing.T) {
+	res := sandbox.Result{Usage: readUsage(t, "usage_ok.json"), MemLimit: 20 << 20, CpuTimeLimit: time.Second}
+
+	util := res.LimitUtilization()
+	if len(util) != 2 || util["memory"] != 0.5 || util["cpu_time"] != 0.12 {
+		t.Fatalf("utilization: %v", util)
+	}
+
+	if util := (&sandbox.Result{MemLimit: 1}).LimitUtilization(); len(util) != 0 {
+		t.Fatalf("utilization without usage: %v", util)
+	}
+
+	withToolPath(t, "/bin/true")
+	run, err := sandbox.New("/root").SetRlimit("cpu", 2).SetWallTimeLimit(5*time.Second).Run(context.Background(), "/bin/prog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.CpuTimeLimit != 2*time.Second || run.WallTimeLimit != 5*time.Second {
+		t.Fatalf("limits: %v, %v", run.CpuTimeLimit, run.WallTimeLimit)
+	}
+}
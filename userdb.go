@@ -0,0 +1,60 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SetupUserDB generates minimal /etc/passwd and /etc/group files that describe the user the
+// sandboxed process runs as, and adds them with AddFile, so that lookups such as getpwuid(3)
+// succeed in a root that has no user database.
+//
+// Both files contain an entry for root and one for username with the given uid, which is also
+// used as its gid; if uid is 0, username names root instead. The name must not contain colons or
+// newlines, which would corrupt the entries. The user's home directory is /tmp and its shell
+// /bin/sh. The files are staged in a temporary host directory, which the returned cleanup function
+// removes; it must be called once the sandboxed process has exited.
+func (s *Sandbox) SetupUserDB(uid int, username string) (cleanup func(), err error) {
+	if uid < 0 || !validUserName(username) {
+		return nil, fmt.Errorf("sandbox: invalid user %q with uid %d", username, uid)
+	}
+
+	dir, err := os.MkdirTemp("", "sandbox-userdb-")
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: stage user database: %w", err)
+	}
+
+	cleanup = func() { os.RemoveAll(dir) }
+
+	passwd := fmt.Sprintf("%s:x:0:0:%[1]s:/root:/bin/sh\n", username)
+	group := fmt.Sprintf("%s:x:0:\n", username)
+	if uid != 0 {
+		passwd = fmt.Sprintf("root:x:0:0:root:/root:/bin/sh\n%s:x:%d:%[2]d:%[1]s:/tmp:/bin/sh\n", username, uid)
+		group = fmt.Sprintf("root:x:0:\n%s:x:%d:\n", username, uid)
+	}
+
+	for _, f := range [][2]string{{"passwd", passwd}, {"group", group}} {
+		src := filepath.Join(dir, f[0])
+		if err := os.WriteFile(src, []byte(f[1]), 0o644); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("sandbox: stage user database: %w", err)
+		}
+
+		s.AddFile(src, "/etc/"+f[0], false)
+	}
+
+	return cleanup, nil
+}
+
+// validUserName reports whether name is non-empty and contains no colon or newline.
+func validUserName(name string) bool {
+	for _, r := range name {
+		switch r {
+		case ':', '\n':
+			return false
+		}
+	}
+
+	return name != ""
+}
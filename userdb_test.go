@@ -0,0 +1,53 @@
+package sandbox_test
+
+import (
+	"os"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestSetupUserDB(t *testing.T) {
+	sbox := sandbox.New("/root")
+
+	cleanup, err := sbox.SetupUserDB(1000, "runner")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mounts := map[string]string{}
+	args := sbox.BuildExecArgs("/bin/true", nil)
+	for i := 0; i+2 < len(args); i++ {
+		if args[i] == "--add_file" {
+			mounts[args[i+2]] = args[i+1]
+		}
+	}
+
+	for dst, want := range map[string]string{
+		"/etc/passwd": "root:x:0:0:root:/root:/bin/sh\nrunner:x:1000:1000:runner:/tmp:/bin/sh\n",
+		"/etc/group":  "root:x:0:\nrunner:x:1000:\n",
+	} {
+		data, err := os.ReadFile(mounts[dst])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Fatalf("%s:\n got: %q\nwant: %q", dst, data, want)
+		}
+	}
+
+	cleanup()
+	if _, err := os.Stat(mounts["/etc/passwd"]); !os.IsNotExist(err) {
+		t.Fatalf("staged file not removed: %v", err)
+	}
+
+	if _, err := sandbox.New("/root").SetupUserDB(-1, "runner"); err == nil {
+		t.Fatal("expected error for negative uid")
+	}
+
+	for _, name := range []string{"", "evil:x:0:0", "runner\nroot"} {
+		if _, err := sandbox.New("/root").SetupUserDB(1000, name); err == nil {
+			t.Fatalf("expected error for user name %q", name)
+		}
+	}
+}
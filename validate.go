@@ -0,0 +1,342 @@
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SetRejectSymlinkSources makes Validate fail if the host source of any file or directory mapping
+// is a symbolic link. A link whose target lies within the prefixes set by SetAllowedSourcePrefixes
+// is still accepted.
+func (s *Sandbox) SetRejectSymlinkSources(v bool) *Sandbox {
+	s.rejectSymlinks = v
+
+	return s
+}
+
+// SetAllowedSourcePrefixes makes Validate fail if the host source of any file or directory mapping,
+// after resolving symbolic links, lies outside all of the given directories. An empty list, the
+// default, allows any source.
+func (s *Sandbox) SetAllowedSourcePrefixes(prefixes []string) *Sandbox {
+	s.srcPrefixes = append([]string(nil), prefixes...)
+
+	return s
+}
+
+// SetAllowedDestPrefixes makes Validate fail if the destination of any file or directory mapping,
+// including the files added by EnableDNS and the /tmp mount of SetTmpDir, lies outside all of the
+// given sandbox directories. It lets a platform restrict where user-supplied configurations may
+// place files, e.g. keep them away from /etc. An empty list, the default, allows any destination.
+func (s *Sandbox) SetAllowedDestPrefixes(prefixes []string) *Sandbox {
+	s.dstPrefixes = append([]string(nil), prefixes...)
+
+	return s
+}
+
+// SetCheckSources makes Validate fail with ErrMissingSource if the host source of any file or
+// directory mapping does not exist.
+func (s *Sandbox) SetCheckSources(v bool) *Sandbox {
+	s.checkSources = v
+
+	return s
+}
+
+// SetNoNesting makes Validate fail with ErrNested if any file or directory mapping would expose
+// the sandbox executable, Path, inside the sandbox.
+func (s *Sandbox) SetNoNesting(v bool) *Sandbox {
+	s.noNesting = v
+
+	return s
+}
+
+// Validate checks the configuration for values that can never be accepted by the sandbox tool,
+// as well as for violations of the policies configured on the builder.
+//
+// It does not try to replicate the tool's own validation; it only reports mistakes that the
+// builder can detect on its own. Errors are of type *ConfigError.
+func (s *Sandbox) Validate() error {
+	for _, check := range []func() error{
+		s.validateRoot,
+		s.validateLimits,
+		s.validateRlimits,
+		s.validateEnv,
+		s.validateMappings,
+		s.validateWritable,
+		s.validateIDMaps,
+		s.validateSysctls,
+		s.validateNetNamespace,
+		s.validateCapabilities,
+	} {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateCommand is identical to Validate, but also checks the command that is going to be run.
+// It reports ErrNested if the command is the sandbox executable itself, either because path equals
+// Path or because path is a file mapped from Path.
+func (s *Sandbox) ValidateCommand(path string) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	if filepath.Clean(path) == filepath.Clean(Path) {
+		return configErr("command", -1, ErrNested, "%s is the sandbox executable", path)
+	}
+
+	for i, f := range s.files {
+		if filepath.Clean(f.dst) == filepath.Clean(path) && filepath.Clean(f.src) == filepath.Clean(Path) {
+			return configErr("file", i, ErrNested, "command %s is the sandbox executable", path)
+		}
+	}
+
+	return nil
+}
+
+// BuildExecArgsE is identical to BuildExecArgs, but validates the configuration and the command
+// first, see ValidateCommand, as well as the emitted flags if SetStrictFlags is set.
+func (s *Sandbox) BuildExecArgsE(path string, args []string) ([]string, error) {
+	if err := s.ValidateCommand(path); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateFlags(); err != nil {
+		return nil, err
+	}
+
+	return s.BuildExecArgs(path, args), nil
+}
+
+func (s *Sandbox) validateRoot() error {
+	if s.path == "" {
+		return configErr("root", -1, ErrEmptyRoot, "sandbox root is empty")
+	}
+
+	return nil
+}
+
+func (s *Sandbox) validateLimits() error {
+	if s.oomScoreAdj != nil && (*s.oomScoreAdj < -1000 || *s.oomScoreAdj > 1000) {
+		return configErr("oom_score_adj", -1, ErrOutOfRange, "%d is out of range [-1000, 1000]", *s.oomScoreAdj)
+	}
+
+	if s.uids != nil {
+		for _, id := range s.uids {
+			if id < -1 {
+				return configErr("uids", -1, ErrOutOfRange, "user ID %d is negative", id)
+			}
+		}
+	}
+
+	if s.nice != nil && (*s.nice < -20 || *s.nice > 19) {
+		return configErr("nice", -1, ErrOutOfRange, "%d is out of range [-20, 19]", *s.nice)
+	}
+
+	if s.cpuMaxQuota != 0 && s.cpuMaxPeriod == 0 {
+		return configErr("cpu_max", -1, ErrOutOfRange, "period is zero")
+	}
+
+	if s.cpuSet != "" {
+		if _, err := cpuSetSize(s.cpuSet); err != nil {
+			return configErr("cpuset", -1, nil, "%q is not a valid CPU list", s.cpuSet)
+		}
+	}
+
+	switch s.propagation {
+	case "", PropagationPrivate, PropagationSlave, PropagationShared:
+	default:
+		return configErr("mount_propagation", -1, nil, "unknown propagation mode %q", s.propagation)
+	}
+
+	if s.limitSignal < 0 || s.limitSignal > 64 {
+		return configErr("time_limit_signal", -1, ErrOutOfRange, "%d is out of range [1, 64]", int(s.limitSignal))
+	}
+
+	if s.elfLibDepth < 0 {
+		return configErr("elf_lib_depth", -1, ErrOutOfRange, "%d is negative", s.elfLibDepth)
+	}
+
+	if s.limitExit < 0 || s.limitExit > 255 {
+		return configErr("limit_exit_code", -1, ErrOutOfRange, "%d is out of range [1, 255]", s.limitExit)
+	}
+
+	if s.schedPolicy != "" {
+		if s.schedPolicy != SchedFIFO && s.schedPolicy != SchedRR {
+			return configErr("sched_policy", -1, nil, "unknown scheduling policy %q", s.schedPolicy)
+		}
+
+		if s.schedPriority < 1 || s.schedPriority > 99 {
+			return configErr("sched_policy", -1, ErrOutOfRange, "priority %d is out of range [1, 99]", s.schedPriority)
+		}
+
+		if !s.allowRealtime {
+			return configErr("sched_policy", -1, nil, "real-time scheduling requires SetAllowRealtime(true)")
+		}
+	}
+
+	return nil
+}
+
+// mapping is a file or directory mapping, as seen by the validation.
+type mapping struct {
+	field string
+	index int
+	src   string
+	dst   string
+	// implicit marks the host files added by EnableDNS, whose sources are not checked.
+	implicit bool
+}
+
+// mappings returns every file and directory the tool is asked to map into the sandbox, including
+// the files added by EnableDNS and the /tmp mount of SetTmpDir.
+func (s *Sandbox) mappings() []mapping {
+	var m []mapping
+	if s.dns && !s.noNewNet {
+		for _, f := range dnsFiles {
+			m = append(m, mapping{field: "dns", index: -1, src: f, dst: f, implicit: true})
+		}
+	}
+	for i, f := range s.files {
+		if f.skipped() {
+			continue
+		}
+		m = append(m, mapping{field: "file", index: i, src: f.src, dst: f.dst})
+	}
+	for i, d := range s.mountDirs {
+		m = append(m, mapping{field: "mount_dir", index: i, src: d.src, dst: d.dst})
+	}
+	if s.tmpDir != "" {
+		m = append(m, mapping{field: "tmp_dir", index: -1, src: s.tmpDir, dst: "/tmp"})
+	}
+
+	return m
+}
+
+func (s *Sandbox) validateMappings() error {
+	dsts := make(map[string]bool)
+
+	for _, m := range s.mappings() {
+		dst := filepath.Clean(m.dst)
+		if dsts[dst] {
+			return configErr(m.field, m.index, ErrDuplicateDst, "destination %s is already used", m.dst)
+		}
+		dsts[dst] = true
+
+		if m.field == "mount_dir" && dst != filepath.Clean(m.src) && withinDir(dst, m.src) {
+			return configErr(m.field, m.index, ErrMountLoop, "destination %s is inside its source %s", m.dst, m.src)
+		}
+
+		if !m.implicit {
+			if s.noNesting && withinDir(Path, m.src) {
+				return configErr(m.field, m.index, ErrNested, "source %s exposes the sandbox executable", m.src)
+			}
+
+			if err := s.validateSource(m); err != nil {
+				return err
+			}
+		}
+
+		if err := s.validateDestination(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Sandbox) validateSource(m mapping) error {
+	if !s.checkSources && !s.rejectSymlinks && len(s.srcPrefixes) == 0 {
+		return nil
+	}
+
+	fi, err := os.Lstat(m.src)
+	if errors.Is(err, os.ErrNotExist) {
+		return configErr(m.field, m.index, ErrMissingSource, "source %s does not exist", m.src)
+	}
+	if err != nil {
+		return configErr(m.field, m.index, err, "source %s: %v", m.src, err)
+	}
+
+	isLink := fi.Mode()&os.ModeSymlink != 0
+	if isLink && s.rejectSymlinks && len(s.srcPrefixes) == 0 {
+		return configErr(m.field, m.index, ErrPolicy, "source %s is a symbolic link", m.src)
+	}
+
+	if len(s.srcPrefixes) == 0 {
+		return nil
+	}
+
+	resolved, err := filepath.EvalSymlinks(m.src)
+	if errors.Is(err, os.ErrNotExist) {
+		return configErr(m.field, m.index, ErrMissingSource, "source %s is a dangling symbolic link", m.src)
+	}
+	if err == nil {
+		resolved, err = filepath.Abs(resolved)
+	}
+	if err != nil {
+		return configErr(m.field, m.index, err, "source %s: %v", m.src, err)
+	}
+
+	for _, prefix := range s.srcPrefixes {
+		if withinDir(resolved, prefix) {
+			return nil
+		}
+	}
+
+	if isLink {
+		return configErr(m.field, m.index, ErrPolicy, "source %s is a symbolic link to %s outside of the allowed directories", m.src, resolved)
+	}
+
+	return configErr(m.field, m.index, ErrPolicy, "source %s is outside of the allowed directories", m.src)
+}
+
+func (s *Sandbox) validateDestination(m mapping) error {
+	if len(s.dstPrefixes) == 0 {
+		return nil
+	}
+
+	for _, prefix := range s.dstPrefixes {
+		if withinDir(m.dst, prefix) {
+			return nil
+		}
+	}
+
+	return configErr(m.field, m.index, ErrPolicy, "destination %s is outside of the allowed directories", m.dst)
+}
+
+func (s *Sandbox) validateWritable() error {
+	for i, d := range s.mountDirs {
+		if d.readOnly && d.quota != 0 {
+			return configErr("mount_dir", i, nil, "read-only mount %s cannot have a quota", d.dst)
+		}
+	}
+
+	for i, w := range s.writable {
+		if !filepath.IsAbs(w) {
+			return configErr("writable", i, nil, "%s is not absolute", w)
+		}
+
+		for _, d := range s.mountDirs {
+			if d.readOnly && withinDir(w, d.dst) {
+				return configErr("writable", i, nil, "%s is within read-only mount %s", w, d.dst)
+			}
+		}
+	}
+
+	return nil
+}
+
+// withinDir reports whether path is dir itself or lies inside it.
+func withinDir(path, dir string) bool {
+	path, dir = filepath.Clean(path), filepath.Clean(dir)
+	if path == dir || dir == "/" {
+		return true
+	}
+
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
@@ -0,0 +1,338 @@
+package sandbox_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestValidateOOMScoreAdj(t *testing.T) {
+	for adj, valid := range map[int]bool{-1000: true, 0: true, 1000: true, -1001: false, 1001: false} {
+		err := sandbox.New("/root").SetOOMScoreAdj(adj).Validate()
+		if (err == nil) != valid {
+			t.Fatalf("adj %d: unexpected validation result %v", adj, err)
+		}
+	}
+}
+
+func TestValidateSchedPolicy(t *testing.T) {
+	sbox := sandbox.New("/root").SetSchedPolicy(sandbox.SchedRR, 10)
+	if err := sbox.Validate(); err == nil {
+		t.Fatal("expected error without SetAllowRealtime")
+	}
+
+	if err := sbox.SetAllowRealtime(true).Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sbox.SetSchedPolicy(sandbox.SchedRR, 100).Validate(); err == nil {
+		t.Fatal("expected error for priority out of range")
+	}
+
+	args := sandbox.New("/root").SetSchedPolicy(sandbox.SchedFIFO, 5).BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--sched_policy", "fifo", "--sched_priority", "5") {
+		t.Fatalf("missing scheduling flags: %q", args)
+	}
+}
+
+func TestValidateSymlinkSources(t *testing.T) {
+	dir := t.TempDir()
+	jail := filepath.Join(dir, "jail")
+	if err := os.Mkdir(jail, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	inside := filepath.Join(jail, "data")
+	outside := filepath.Join(dir, "secret")
+	for _, p := range []string{inside, outside} {
+		if err := os.WriteFile(p, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	linkIn := filepath.Join(jail, "link-in")
+	linkOut := filepath.Join(jail, "link-out")
+	if err := os.Symlink(inside, linkIn); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, linkOut); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sandbox.New("/root").AddFile(linkOut, "/x", false).Validate(); err != nil {
+		t.Fatalf("symlinks must be accepted by default: %v", err)
+	}
+
+	reject := func(src string) *sandbox.Sandbox {
+		return sandbox.New("/root").SetRejectSymlinkSources(true).AddFile(src, "/x", false)
+	}
+
+	if err := reject(inside).Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reject(linkIn).BuildExecArgsE("/bin/true", nil); err == nil {
+		t.Fatal("expected error for symlink source")
+	}
+
+	if err := reject(linkIn).SetAllowedSourcePrefixes([]string{jail}).Validate(); err != nil {
+		t.Fatalf("symlink within allowed prefix: %v", err)
+	}
+
+	if err := reject(linkOut).SetAllowedSourcePrefixes([]string{jail}).Validate(); err == nil {
+		t.Fatal("expected error for symlink escaping allowed prefix")
+	}
+}
+
+func TestValidateReadOnlyRoot(t *testing.T) {
+	sbox := sandbox.New("/root").MountDirReadOnly("/srv/data", "/data").SetReadOnlyRootWithWritable("/tmp", "/out")
+
+	args, err := sbox.BuildExecArgsE("/bin/true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !hasArgs(args, "--read_only_root", "--writable", "/tmp", "--writable", "/out") {
+		t.Fatalf("unexpected flags: %q", args)
+	}
+
+	if err := sbox.SetReadOnlyRootWithWritable("/data/cache").Validate(); err == nil {
+		t.Fatal("expected error for writable path within read-only mount")
+	}
+
+	if err := sbox.SetReadOnlyRootWithWritable("tmp").Validate(); err == nil {
+		t.Fatal("expected error for relative writable path")
+	}
+}
+
+func TestSetRlimit(t *testing.T) {
+	sbox := sandbox.New("/root").SetRlimit("nofile", 64).SetRlimit("nproc", 16).SetRlimit("nofile", 128)
+
+	args, err := sbox.BuildExecArgsE("/bin/true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !hasArgs(args, "--rlimit", "nofile=128", "--rlimit", "nproc=16") || hasArgs(args, "nofile=64") {
+		t.Fatalf("unexpected rlimit flags: %q", args)
+	}
+
+	if err := sbox.SetRlimit("inotify", 1).Validate(); err == nil {
+		t.Fatal("expected error for unknown resource")
+	}
+}
+
+func TestSetMsgQueueLimit(t *testing.T) {
+	sbox := sandbox.New("/root").SetMsgQueueLimit(1 << 16)
+	if args := sbox.BuildExecArgs("/bin/true", nil); !hasArgs(args, "--rlimit", "msgqueue=65536") {
+		t.Fatalf("missing msgqueue limit: %q", args)
+	}
+
+	if args := sbox.SetMsgQueueLimit(0).BuildExecArgs("/bin/true", nil); hasArgs(args, "--rlimit") {
+		t.Fatalf("unexpected rlimit flags: %q", args)
+	}
+}
+
+func TestSetRlimits(t *testing.T) {
+	sbox := sandbox.New("/root")
+	if err := sbox.SetRlimits("as=256M, nproc=64,nofile=1024,cpu=10,core=unlimited,fsize=2k"); err != nil {
+		t.Fatal(err)
+	}
+
+	args := sbox.BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--rlimit", "as=268435456", "--rlimit", "nproc=64", "--rlimit", "nofile=1024",
+		"--rlimit", "cpu=10", "--rlimit", "core=18446744073709551615", "--rlimit", "fsize=2048") {
+		t.Fatalf("unexpected rlimit flags: %q", args)
+	}
+
+	for spec, entry := range map[string]string{
+		"nofile":           `"nofile"`,
+		"inotify=1":        `"inotify=1"`,
+		"nofile=x":         `"nofile=x"`,
+		"as=1Q":            `"as=1Q"`,
+		"as=99999999999T":  `"as=99999999999T"`,
+		"nproc=1,stack=-1": `"stack=-1"`,
+	} {
+		if err := sandbox.New("/root").SetRlimits(spec); err == nil || !strings.Contains(err.Error(), entry) {
+			t.Fatalf("spec %q: unexpected error %v", spec, err)
+		}
+	}
+
+	sbox = sandbox.New("/root")
+	if sbox.SetRlimits("nproc=1,stack=-1"); hasArgs(sbox.BuildExecArgs("/bin/true", nil), "--rlimit") {
+		t.Fatal("limits were set despite the error")
+	}
+}
+
+func TestValidateDestPrefixes(t *testing.T) {
+	sbox := sandbox.New("/root").SetAllowedDestPrefixes([]string{"/work", "/opt"}).
+		AddFile("/usr/bin/prog", "/work/prog", true).
+		MountDir("/srv/data", "/opt/data")
+
+	if err := sbox.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sbox.AddFile("/tmp/passwd", "/etc/passwd", false).Validate(); err == nil {
+		t.Fatal("expected error for destination outside allowed prefixes")
+	}
+
+	if err := sandbox.New("/root").MountDir("/work", "/workspace").SetAllowedDestPrefixes([]string{"/work"}).Validate(); err == nil {
+		t.Fatal("prefix must match whole path components")
+	}
+
+	if err := sandbox.New("/root").SetAllowedDestPrefixes([]string{"/work"}).EnableDNS().Validate(); err == nil {
+		t.Fatal("expected error for the DNS files outside allowed prefixes")
+	}
+
+	if err := sandbox.New("/root").SetAllowedDestPrefixes([]string{"/work"}).SetTmpDir("/h").Validate(); err == nil {
+		t.Fatal("expected error for the tmp dir outside allowed prefixes")
+	}
+
+	if err := sandbox.New("/root").SetAllowedDestPrefixes([]string{"/work", "/etc", "/tmp"}).EnableDNS().SetTmpDir("/h").Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	existing := t.TempDir()
+
+	for _, tc := range []struct {
+		name  string
+		sbox  *sandbox.Sandbox
+		cause error
+		field string
+		index int
+	}{
+		{"empty root", sandbox.New(""), sandbox.ErrEmptyRoot, "root", -1},
+		{"duplicate dst", sandbox.New("/root").AddFile("/a", "/x", false).MountDir("/b", "/x/"), sandbox.ErrDuplicateDst, "mount_dir", 0},
+		{"duplicate dns dst", sandbox.New("/root").EnableDNS().AddFile("/a", "/etc/hosts", false), sandbox.ErrDuplicateDst, "file", 0},
+		{"duplicate tmp dst", sandbox.New("/root").MountDir("/data", "/tmp").SetTmpDir("/h"), sandbox.ErrDuplicateDst, "tmp_dir", -1},
+		{"missing source", sandbox.New("/root").SetCheckSources(true).MountDir(existing, "/a").AddFile("/nonexistent", "/b", false), sandbox.ErrMissingSource, "file", 0},
+		{"out of range", sandbox.New("/root").SetNice(40), sandbox.ErrOutOfRange, "nice", -1},
+		{"signal out of range", sandbox.New("/root").SetTimeLimitSignal(99), sandbox.ErrOutOfRange, "time_limit_signal", -1},
+	} {
+		err := tc.sbox.Validate()
+		if !errors.Is(err, tc.cause) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.cause, err)
+			continue
+		}
+
+		var cfgErr *sandbox.ConfigError
+		if !errors.As(err, &cfgErr) || cfgErr.Field != tc.field || cfgErr.Index != tc.index {
+			t.Errorf("%s: unexpected error %#v", tc.name, err)
+		}
+	}
+}
+
+func TestValidateNesting(t *testing.T) {
+	if err := sandbox.New("/root").ValidateCommand(sandbox.Path); !errors.Is(err, sandbox.ErrNested) {
+		t.Fatalf("expected ErrNested, got %v", err)
+	}
+
+	sbox := sandbox.New("/root").AddFile(sandbox.Path, "/bin/tool", false)
+	if _, err := sbox.BuildExecArgsE("/bin/tool", nil); !errors.Is(err, sandbox.ErrNested) {
+		t.Fatalf("expected ErrNested, got %v", err)
+	}
+
+	if err := sbox.ValidateCommand("/bin/prog"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sbox.SetNoNesting(true).ValidateCommand("/bin/prog"); !errors.Is(err, sandbox.ErrNested) {
+		t.Fatalf("expected ErrNested for exposed executable, got %v", err)
+	}
+
+	dir := filepath.Dir(sandbox.Path)
+	if err := sandbox.New("/root").SetNoNesting(true).MountDir(dir, dir).Validate(); !errors.Is(err, sandbox.ErrNested) {
+		t.Fatalf("expected ErrNested for mounted directory, got %v", err)
+	}
+}
+
+func TestValidateMountPropagation(t *testing.T) {
+	for mode, valid := range map[sandbox.PropagationMode]bool{"": true, sandbox.PropagationShared: true, "rshared": false} {
+		err := sandbox.New("/root").SetMountPropagation(mode).Validate()
+		if (err == nil) != valid {
+			t.Fatalf("mode %q: unexpected validation result %v", mode, err)
+		}
+	}
+
+	if args := sandbox.New("/root").BuildExecArgs("/bin/true", nil); hasArgs(args, "--mount_propagation") {
+		t.Fatalf("unexpected propagation flag: %q", args)
+	}
+}
+
+func TestValidateMountLoop(t *testing.T) {
+	err := sandbox.New("/root").MountDir("/data", "/data/sub").Validate()
+	if !errors.Is(err, sandbox.ErrMountLoop) {
+		t.Fatalf("expected ErrMountLoop, got %v", err)
+	}
+
+	for _, dst := range []string{"/data", "/data/", "/database", "/mnt/data"} {
+		if err := sandbox.New("/root").MountDir("/data", dst).Validate(); err != nil {
+			t.Fatalf("dst %s: %v", dst, err)
+		}
+	}
+}
+
+func TestMountDirQuota(t *testing.T) {
+	sbox := sandbox.New("/root").MountDirQuota("/srv/out", "/out", 1<<20)
+	if args := sbox.BuildExecArgs("/bin/true", nil); !hasArgs(args, "--mount_dir_quota", "/srv/out", "/out", "1048576") {
+		t.Fatalf("missing quota mount: %q", args)
+	}
+
+	err := sandbox.New("/root").MountDirs(sandbox.DirMapping{Src: "/data", Dst: "/data", ReadOnly: true, Quota: 1}).Validate()
+	if err == nil {
+		t.Fatal("expected error for read-only mount with a quota")
+	}
+}
+
+func TestMountDirIDMap(t *testing.T) {
+	uids := []sandbox.IDMapEntry{{ContainerID: 0, HostID: 1000, Size: 1}, {ContainerID: 1, HostID: 100000, Size: 65536}}
+	sbox := sandbox.New("/root").MountDirIDMap("/home/u", "/data", uids, nil)
+
+	args, err := sbox.BuildExecArgsE("/bin/true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasArgs(args, "--mount_dir", "/home/u", "/data", "--uid_map", "/data", "0:1000:1,1:100000:65536") || hasArgs(args, "--gid_map") {
+		t.Fatalf("unexpected ID map flags: %q", args)
+	}
+
+	if m := sbox.Mounts(); len(m) != 1 || !reflect.DeepEqual(m[0].UIDMap, uids) || m[0].GIDMap != nil {
+		t.Fatalf("unexpected mounts: %+v", m)
+	}
+
+	empty := []sandbox.IDMapEntry{{ContainerID: 0, HostID: 1000}}
+	if err := sandbox.New("/root").MountDirIDMap("/home/u", "/data", nil, empty).Validate(); err == nil {
+		t.Fatal("expected error for an empty ID range")
+	}
+}
+
+func TestValidateSysctl(t *testing.T) {
+	for _, tc := range []struct {
+		sbox  *sandbox.Sandbox
+		valid bool
+	}{
+		{sandbox.New("/root").SetNoNewNet(true).SetSysctl("net.ipv4.ip_forward", "1"), true},
+		{sandbox.New("/root").SetSysctl("net.ipv4.ip_forward", "1"), false},
+		{sandbox.New("/root").SetNamespaces(sandbox.NamespaceIPC).SetSysctl("fs.mqueue.msg_max", "10"), true},
+		{sandbox.New("/root").SetSysctl("kernel.shmmax", "1024"), false},
+		{sandbox.New("/root").SetNamespaces(sandbox.NamespaceIPC).SetSysctl("vm.overcommit_memory", "1"), false},
+	} {
+		err := tc.sbox.Validate()
+		if (err == nil) != tc.valid {
+			t.Fatalf("%s: unexpected validation result %v", tc.sbox.ConfigString(), err)
+		}
+	}
+
+	sbox := sandbox.New("/root").SetNoNewNet(true).SetSysctl("net.core.somaxconn", "64").SetSysctl("net.core.somaxconn", "128")
+	if args := sbox.BuildExecArgs("/bin/true", nil); !hasArgs(args, "--sysctl", "net.core.somaxconn=128") || hasArgs(args, "net.core.somaxconn=64") {
+		t.Fatalf("unexpected sysctl flags: %q", args)
+	}
+}
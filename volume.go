@@ -0,0 +1,31 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+)
+
+// VolumeResolver maps a volume name to the host directory that holds it. It is used by MountVolume
+// and must be set before volumes can be mounted.
+var VolumeResolver func(name string) (hostPath string, err error)
+
+// ErrNoVolumeResolver is returned by MountVolume when VolumeResolver is not set.
+var ErrNoVolumeResolver = errors.New("sandbox: volume resolver is not set")
+
+// MountVolume resolves a named volume through VolumeResolver and mounts it read-only at dst.
+//
+// The name is resolved immediately, so later changes of the resolver do not affect this mount.
+func (s *Sandbox) MountVolume(name, dst string) error {
+	if VolumeResolver == nil {
+		return ErrNoVolumeResolver
+	}
+
+	src, err := VolumeResolver(name)
+	if err != nil {
+		return fmt.Errorf("sandbox: resolve volume %q: %w", name, err)
+	}
+
+	s.MountDirReadOnly(src, dst)
+
+	return nil
+}
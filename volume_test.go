@@ -0,0 +1,38 @@
+package sandbox_test
+
+import (
+	"errors"
+	"testing"
+
+	sandbox "github.com/Highload-fun/libsandbox"
+)
+
+func TestMountVolume(t *testing.T) {
+	defer func() { sandbox.VolumeResolver = nil }()
+
+	sbox := sandbox.New("/root")
+	if err := sbox.MountVolume("data", "/data"); !errors.Is(err, sandbox.ErrNoVolumeResolver) {
+		t.Fatalf("expected ErrNoVolumeResolver, got %v", err)
+	}
+
+	sandbox.VolumeResolver = func(name string) (string, error) {
+		if name != "data" {
+			return "", errors.New("unknown volume")
+		}
+
+		return "/srv/volumes/data", nil
+	}
+
+	if err := sbox.MountVolume("data", "/data"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sbox.MountVolume("other", "/other"); err == nil {
+		t.Fatal("expected resolver error")
+	}
+
+	args := sbox.BuildExecArgs("/bin/true", nil)
+	if !hasArgs(args, "--mount_dir_ro", "/srv/volumes/data", "/data") || hasArgs(args, "/other") {
+		t.Fatalf("unexpected mounts: %q", args)
+	}
+}